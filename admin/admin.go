@@ -0,0 +1,416 @@
+// Package admin provides an optional net/http handler, for inspecting and
+// manipulating the jobs and the queues, meant for the operations staff.
+//
+// The handler serves the following endpoints, relative to where it is mounted:
+//  GET    /jobs                   lists the jobs in the store, ?status= filters by status,
+//                                 and ?tag=key=value, repeatable, by tags
+//  POST   /jobs                   enqueues the job in the request body
+//  POST   /jobs/cancel?tag=k=v    cancels the scheduled and running jobs with the tags
+//  POST   /jobs/reschedule?tag=k=v
+//                                 moves the scheduled jobs with the tags to the exec_time,
+//                                 or after the delay in milliseconds, in the request body
+//  GET    /jobs/{id}              returns the record of the job
+//  DELETE /jobs/{id}              cancels the job, same as POST /jobs/{id}/cancel
+//  POST   /jobs/{id}/retry        enqueues a failed, cancelled or finished job again
+//  GET    /jobs/{id}/result       returns the result of the latest execution of the job
+//  GET    /stats                  counts of jobs per type and status, and the jobs
+//                                 whose last run finished in each minute of the last hour
+//  GET    /executors              lists the registered job types
+//  GET    /queues                 lists the queues with the number of messages in them
+//  POST   /queues/{name}/pause    pauses consumption from the queue
+//  POST   /queues/{name}/resume   resumes consumption from the queue
+//  GET    /types                  lists the registered job types, and whether they are paused
+//  POST   /types/{type}/pause     holds back the jobs of the type
+//  POST   /types/{type}/resume    resumes executing the jobs of the type
+//
+// Pausing is effective across the processes sharing the store registered
+// with jobs.RegisterPauseStore, or only in this process if none is registered.
+//
+// The handler enqueues jobs of any registered type, and cancels, retries
+// and pauses any job or queue, it must not be reachable by anyone who is
+// not trusted with running the registered executors. It does not
+// authenticate the requests itself, either mount it behind an
+// authenticating middleware, or pass an Authorizer with WithAuthorizer.
+// As browsers send the basic authentication credentials along with cross
+// site form posts, the requests other than GET and HEAD are refused without
+// the X-Requested-With header, which cross site forms can't send:
+//  curl -u ops -X POST -H "X-Requested-With: curl" http://localhost:8080/admin/queues/q/pause
+//
+// Mount it with http.StripPrefix, for eg:
+//  http.Handle("/admin/", http.StripPrefix("/admin",
+//  	admin.NewHandler(admin.WithAuthorizer(admin.BasicAuth("ops", os.Getenv("ADMIN_PASSWORD"))))))
+package admin
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/betacraft/scheduler/jobs"
+)
+
+type handler struct {
+	authorize Authorizer
+}
+
+// Authorizer is called with every request before it is served, the request
+// is refused with 401 Unauthorized if it returns false, which prompts the
+// browsers for basic authentication
+type Authorizer func(r *http.Request) bool
+
+// CSRFHeader is the header required, with any value,
+// on the requests other than GET and HEAD
+const CSRFHeader = "X-Requested-With"
+
+// Option configures the handler returned by NewHandler
+type Option func(h *handler)
+
+// WithAuthorizer authorizes the requests with a
+func WithAuthorizer(a Authorizer) Option {
+	return func(h *handler) {
+		h.authorize = a
+	}
+}
+
+// BasicAuth returns an Authorizer accepting the requests with
+// the user and password, through HTTP basic authentication
+func BasicAuth(user, password string) Authorizer {
+	return func(r *http.Request) bool {
+		u, p, ok := r.BasicAuth()
+		if !ok {
+			return false
+		}
+		// both compared, not to leak which one is wrong
+		uok := subtle.ConstantTimeCompare([]byte(u), []byte(user)) == 1
+		pok := subtle.ConstantTimeCompare([]byte(p), []byte(password)) == 1
+		return uok && pok
+	}
+}
+
+// NewHandler returns the admin http handler, it uses the registered
+// Doer for enqueueing and listing queues, and the registered store for jobs.
+// Every request is served unless an Authorizer is passed, check the
+// package documentation.
+func NewHandler(opts ...Option) http.Handler {
+	h := &handler{}
+	for _, o := range opts {
+		o(h)
+	}
+	return h
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.authorize != nil && !h.authorize(r) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="scheduler"`)
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	if r.Method != "GET" && r.Method != "HEAD" && r.Header.Get(CSRFHeader) == "" {
+		writeError(w, http.StatusForbidden, "missing "+CSRFHeader+" header")
+		return
+	}
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case parts[0] == "jobs" && len(parts) == 1 && r.Method == "GET":
+		h.listJobs(w, r)
+	case parts[0] == "jobs" && len(parts) == 1 && r.Method == "POST":
+		h.enqueue(w, r)
+	case parts[0] == "jobs" && len(parts) == 2 && parts[1] == "cancel" && r.Method == "POST":
+		h.cancelByTags(w, r)
+	case parts[0] == "jobs" && len(parts) == 2 && parts[1] == "reschedule" && r.Method == "POST":
+		h.rescheduleByTags(w, r)
+	case parts[0] == "jobs" && len(parts) == 2 && r.Method == "GET":
+		h.getJob(w, parts[1])
+	case parts[0] == "jobs" && len(parts) == 2 && r.Method == "DELETE":
+		h.cancel(w, parts[1])
+	case parts[0] == "jobs" && len(parts) == 3 && parts[2] == "cancel" && r.Method == "POST":
+		h.cancel(w, parts[1])
+	case parts[0] == "jobs" && len(parts) == 3 && parts[2] == "retry" && r.Method == "POST":
+		h.retry(w, parts[1])
+	case parts[0] == "jobs" && len(parts) == 3 && parts[2] == "result" && r.Method == "GET":
+		h.getResult(w, parts[1])
+	case parts[0] == "stats" && len(parts) == 1 && r.Method == "GET":
+		h.stats(w)
+	case parts[0] == "executors" && len(parts) == 1 && r.Method == "GET":
+		writeJSON(w, http.StatusOK, jobs.ExecutorTypes())
+	case parts[0] == "queues" && len(parts) == 1 && r.Method == "GET":
+		h.listQueues(w)
+	case parts[0] == "queues" && len(parts) == 3 && parts[2] == "pause" && r.Method == "POST":
+		h.setPaused(w, "queue", parts[1], jobs.PauseQueue, "paused")
+	case parts[0] == "queues" && len(parts) == 3 && parts[2] == "resume" && r.Method == "POST":
+		h.setPaused(w, "queue", parts[1], jobs.ResumeQueue, "resumed")
+	case parts[0] == "types" && len(parts) == 1 && r.Method == "GET":
+		h.listTypes(w)
+	case parts[0] == "types" && len(parts) == 3 && parts[2] == "pause" && r.Method == "POST":
+		h.setPaused(w, "type", parts[1], jobs.PauseType, "paused")
+	case parts[0] == "types" && len(parts) == 3 && parts[2] == "resume" && r.Method == "POST":
+		h.setPaused(w, "type", parts[1], jobs.ResumeType, "resumed")
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+func (h *handler) listJobs(w http.ResponseWriter, r *http.Request) {
+	tags, err := jobs.ParseTags(r.URL.Query()["tag"])
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	records, err := jobs.FindByTags(tags)
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	status := jobs.Status(r.URL.Query().Get("status"))
+	list := []*jobs.Record{}
+	for _, v := range records {
+		if status == "" || v.Status == status {
+			list = append(list, v)
+		}
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// enqueue fills up ID, EnqueueTime and ExecTime if not provided
+func (h *handler) enqueue(w http.ResponseWriter, r *http.Request) {
+	j := &jobs.Job{}
+	err := json.NewDecoder(r.Body).Decode(j)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid job: "+err.Error())
+		return
+	}
+	now := jobs.Now()
+	if j.ID == "" {
+		j.ID, err = newID()
+		if err != nil {
+			writeErr(w, err)
+			return
+		}
+	}
+	if j.EnqueueTime.IsZero() {
+		j.EnqueueTime = now
+	}
+	if j.ExecTime.IsZero() {
+		j.ExecTime = now.Add(time.Duration(j.Interval) * time.Millisecond)
+	}
+	err = jobs.Enqueue(j)
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	log.Print("admin: enqueued job ", j.ID, " ", j.Type)
+	writeJSON(w, http.StatusCreated, j)
+}
+
+func (h *handler) getJob(w http.ResponseWriter, id string) {
+	rec, err := jobs.GetRecord(id)
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, rec)
+}
+
+func (h *handler) getResult(w http.ResponseWriter, id string) {
+	res, err := jobs.GetResult(id)
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (h *handler) cancel(w http.ResponseWriter, id string) {
+	err := jobs.Cancel(id)
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	log.Print("admin: cancelled job ", id)
+	h.getJob(w, id)
+}
+
+func (h *handler) retry(w http.ResponseWriter, id string) {
+	err := jobs.Retry(id)
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	log.Print("admin: retried job ", id)
+	h.getJob(w, id)
+}
+
+func (h *handler) cancelByTags(w http.ResponseWriter, r *http.Request) {
+	tags, err := jobs.ParseTags(r.URL.Query()["tag"])
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	n, err := jobs.CancelByTags(tags)
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	log.Print("admin: cancelled jobs with tags ", tags, ": ", n)
+	writeJSON(w, http.StatusOK, map[string]int{"cancelled": n})
+}
+
+func (h *handler) rescheduleByTags(w http.ResponseWriter, r *http.Request) {
+	tags, err := jobs.ParseTags(r.URL.Query()["tag"])
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	var req struct {
+		ExecTime time.Time `json:"exec_time"`
+		Delay    int64     `json:"delay"`
+	}
+	err = json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request: "+err.Error())
+		return
+	}
+	if req.ExecTime.IsZero() {
+		req.ExecTime = jobs.Now().Add(time.Duration(req.Delay) * time.Millisecond)
+	}
+	n, err := jobs.RescheduleByTags(tags, req.ExecTime)
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	log.Print("admin: rescheduled jobs with tags ", tags, ": ", n)
+	writeJSON(w, http.StatusOK, map[string]int{"rescheduled": n})
+}
+
+// TypeStats are the statistics of the jobs of a type in the store
+type TypeStats struct {
+	Type   string              `json:"type"`
+	Counts map[jobs.Status]int `json:"counts"`
+
+	// Jobs whose last run succeeded and failed in each minute
+	// of the last hour, oldest minute first
+	Succeeded []int `json:"succeeded"`
+	Failed    []int `json:"failed"`
+}
+
+func (h *handler) stats(w http.ResponseWriter) {
+	records, err := jobs.ListRecords()
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	const minutes = 60
+	now := jobs.Now()
+	byType := map[string]*TypeStats{}
+	types := []string{}
+	for _, r := range records {
+		st, ok := byType[r.Job.Type]
+		if !ok {
+			st = &TypeStats{Type: r.Job.Type, Counts: map[jobs.Status]int{},
+				Succeeded: make([]int, minutes), Failed: make([]int, minutes)}
+			byType[r.Job.Type] = st
+			types = append(types, r.Job.Type)
+		}
+		st.Counts[r.Status]++
+		// the last run of recurring jobs too, which are scheduled again
+		if r.LastRunAt.IsZero() {
+			continue
+		}
+		ago := int(now.Sub(r.LastRunAt) / time.Minute)
+		if ago < 0 || ago >= minutes {
+			continue
+		}
+		switch r.LastStatus {
+		case jobs.StatusSucceeded:
+			st.Succeeded[minutes-1-ago]++
+		case jobs.StatusFailed, jobs.StatusDead:
+			st.Failed[minutes-1-ago]++
+		}
+	}
+	sort.Strings(types)
+	list := make([]*TypeStats, 0, len(types))
+	for _, t := range types {
+		list = append(list, byType[t])
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (h *handler) listQueues(w http.ResponseWriter) {
+	queues, err := jobs.Queues()
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, queues)
+}
+
+// setPaused pauses or resumes the queue or job type name, with set
+func (h *handler) setPaused(w http.ResponseWriter, kind, name string, set func(string) error, state string) {
+	err := set(name)
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	log.Print("admin: ", state, " ", kind, " ", name)
+	writeJSON(w, http.StatusOK, map[string]string{kind: name, "state": state})
+}
+
+// TypeInfo describes a registered job type
+type TypeInfo struct {
+	Type   string `json:"type"`
+	Paused bool   `json:"paused"`
+}
+
+func (h *handler) listTypes(w http.ResponseWriter) {
+	list := []TypeInfo{}
+	for _, t := range jobs.ExecutorTypes() {
+		list = append(list, TypeInfo{Type: t, Paused: jobs.TypePaused(t)})
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		log.Print("admin: error writing response: ", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, code int, msg string) {
+	writeJSON(w, code, map[string]string{"error": msg})
+}
+
+// writeErr maps the errors from the jobs package to the status codes
+func writeErr(w http.ResponseWriter, err error) {
+	var verr *jobs.ValidationError
+	switch {
+	case errors.As(err, &verr):
+		writeError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, jobs.ErrNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, jobs.ErrNoStore), errors.Is(err, jobs.ErrNotSupported):
+		writeError(w, http.StatusNotImplemented, err.Error())
+	case errors.Is(err, jobs.ErrAlreadyScheduled), errors.Is(err, jobs.ErrJobActive):
+		writeError(w, http.StatusConflict, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+func newID() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,162 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/betacraft/scheduler/jobs"
+	"github.com/betacraft/scheduler/schedulertest"
+	"github.com/betacraft/scheduler/store"
+)
+
+func TestAuthorizer(t *testing.T) {
+	h := NewHandler(WithAuthorizer(BasicAuth("ops", "secret")))
+	cases := []struct {
+		user, password string
+		code           int
+	}{
+		{"", "", http.StatusUnauthorized},
+		{"ops", "wrong", http.StatusUnauthorized},
+		{"other", "secret", http.StatusUnauthorized},
+		{"ops", "secret", http.StatusOK},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest("GET", "/executors", nil)
+		if c.user != "" {
+			r.SetBasicAuth(c.user, c.password)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != c.code {
+			t.Errorf("%s:%s got %d, want %d", c.user, c.password, w.Code, c.code)
+		}
+	}
+}
+
+func TestNoAuthorizer(t *testing.T) {
+	w := httptest.NewRecorder()
+	NewHandler().ServeHTTP(w, httptest.NewRequest("GET", "/executors", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("got %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestNewID(t *testing.T) {
+	a, err := newID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := newID()
+	if len(a) != 32 || a == b {
+		t.Errorf("ids %q and %q", a, b)
+	}
+}
+
+func TestCSRFHeader(t *testing.T) {
+	h := NewHandler(WithAuthorizer(BasicAuth("ops", "secret")))
+	cases := []struct {
+		method, path string
+		header       bool
+		code         int
+	}{
+		{"GET", "/executors", false, http.StatusOK},
+		{"POST", "/queues/q/pause", false, http.StatusForbidden},
+		{"POST", "/jobs", false, http.StatusForbidden},
+		{"DELETE", "/jobs/1", false, http.StatusForbidden},
+		{"POST", "/nothing", true, http.StatusNotFound},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest(c.method, c.path, nil)
+		r.SetBasicAuth("ops", "secret")
+		if c.header {
+			r.Header.Set(CSRFHeader, "test")
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != c.code {
+			t.Errorf("%s %s got %d, want %d", c.method, c.path, w.Code, c.code)
+		}
+	}
+}
+
+func TestStatsLastRun(t *testing.T) {
+	s := store.NewMemoryStore()
+	jobs.RegisterStore(s)
+	defer jobs.RegisterStore(nil)
+	now := jobs.Now()
+	// a recurring job scheduled again after failing, and one never run
+	s.Save(&jobs.Record{Job: &jobs.Job{ID: "1", Type: "report"}, Status: jobs.StatusScheduled,
+		LastRunAt: now.Add(-90 * time.Second), LastStatus: jobs.StatusFailed, LastError: "boom"})
+	s.Save(&jobs.Record{Job: &jobs.Job{ID: "2", Type: "report"}, Status: jobs.StatusScheduled})
+
+	w := httptest.NewRecorder()
+	NewHandler().ServeHTTP(w, httptest.NewRequest("GET", "/stats", nil))
+	var list []TypeStats
+	if err := json.NewDecoder(w.Body).Decode(&list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].Counts[jobs.StatusScheduled] != 2 {
+		t.Fatalf("got %+v", list)
+	}
+	if list[0].Failed[58] != 1 {
+		t.Errorf("failed run not counted, got %v", list[0].Failed)
+	}
+}
+
+// serve sends the request to a handler without an authorizer
+func serve(method, target, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	r.Header.Set(CSRFHeader, "test")
+	w := httptest.NewRecorder()
+	NewHandler().ServeHTTP(w, r)
+	return w
+}
+
+func TestTagEndpoints(t *testing.T) {
+	s := store.NewMemoryStore()
+	jobs.RegisterStore(s)
+	defer jobs.RegisterStore(nil)
+	d := schedulertest.NewT(t)
+	jobs.RegisterType("TestTags")
+	for id, tenant := range map[string]string{"1": "acme", "2": "acme", "3": "other"} {
+		s.Save(&jobs.Record{Job: &jobs.Job{ID: id, Type: "TestTags", Tags: map[string]string{"tenant": tenant}},
+			Status: jobs.StatusScheduled})
+	}
+
+	w := serve("GET", "/jobs?tag=tenant=acme", "")
+	var list []jobs.Record
+	if err := json.NewDecoder(w.Body).Decode(&list); err != nil || len(list) != 2 {
+		t.Errorf("got %d jobs, %v, want 2", len(list), err)
+	}
+	if w := serve("GET", "/jobs?tag=tenant", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("got %d for an invalid tag, want %d", w.Code, http.StatusBadRequest)
+	}
+	if w := serve("POST", "/jobs/cancel", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("got %d without tags, want %d", w.Code, http.StatusBadRequest)
+	}
+
+	w = serve("POST", "/jobs/reschedule?tag=tenant=acme", `{"delay":60000}`)
+	var res map[string]int
+	json.NewDecoder(w.Body).Decode(&res)
+	if w.Code != http.StatusOK || res["rescheduled"] != 2 || len(d.Enqueued()) != 2 {
+		t.Errorf("got %d, %v with %d jobs enqueued, want 2 rescheduled", w.Code, res, len(d.Enqueued()))
+	}
+	r, _ := s.Get("1")
+	if want := jobs.Now().Add(time.Minute); !r.Job.ExecTime.Equal(want) {
+		t.Errorf("got %v, want %v", r.Job.ExecTime, want)
+	}
+
+	w = serve("POST", "/jobs/cancel?tag=tenant=acme", "")
+	res = nil
+	json.NewDecoder(w.Body).Decode(&res)
+	if w.Code != http.StatusOK || res["cancelled"] != 2 {
+		t.Errorf("got %d, %v, want 2 cancelled", w.Code, res)
+	}
+	if r, _ := s.Get("3"); r.Status != jobs.StatusScheduled {
+		t.Errorf("job of another tenant %s", r.Status)
+	}
+}
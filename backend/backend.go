@@ -0,0 +1,92 @@
+// Package backend constructs the queue implementations by name, from the
+// configuration, so that the backend can be chosen by the deployment
+// configuration, instead of by the packages imported:
+//
+//  c, err := config.Load("scheduler.yaml")
+//  ...
+//  err = backend.Use(c)
+//
+// The built-in backends are "rmq", "sqs" and "memory", others can be added
+// with Register.
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+
+	"github.com/betacraft/scheduler/config"
+	"github.com/betacraft/scheduler/jobs"
+	"github.com/betacraft/scheduler/queue/memory"
+	"github.com/betacraft/scheduler/queue/rmq"
+	"github.com/betacraft/scheduler/queue/sqs"
+)
+
+// Returned by New when no backend is registered with the name in the configuration
+var ErrUnknownBackend = errors.New("unknown backend")
+
+// Factory connects to the backend with the configuration,
+// and returns its queue implementation
+type Factory func(c *config.Config) (jobs.Doer, error)
+
+var mu sync.Mutex
+var factories = map[string]Factory{
+	"rmq": func(c *config.Config) (jobs.Doer, error) {
+		return rmq.New(c.RMQ)
+	},
+	"sqs": func(c *config.Config) (jobs.Doer, error) {
+		return sqs.New(c.SQS)
+	},
+	"memory": func(c *config.Config) (jobs.Doer, error) {
+		return memory.New(), nil
+	},
+}
+
+// Register adds a backend, or replaces the one with the same name
+func Register(name string, f Factory) {
+	mu.Lock()
+	defer mu.Unlock()
+	factories[name] = f
+}
+
+// Names returns the names of the registered backends, sorted
+func Names() []string {
+	mu.Lock()
+	defer mu.Unlock()
+	names := make([]string, 0, len(factories))
+	for k := range factories {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// New validates the configuration, and constructs the backend named by
+// c.Backend, it returns an error wrapping ErrUnknownBackend for an
+// unregistered name
+func New(c *config.Config) (jobs.Doer, error) {
+	err := c.Validate()
+	if err != nil {
+		return nil, err
+	}
+	mu.Lock()
+	f, ok := factories[c.Backend]
+	mu.Unlock()
+	if !ok {
+		return nil, &config.Error{Field: "backend", Err: fmt.Errorf("%w %q, expected one of %v", ErrUnknownBackend, c.Backend, Names())}
+	}
+	return f(c)
+}
+
+// Use constructs the backend with New, and registers it with the jobs package
+func Use(c *config.Config) error {
+	d, err := New(c)
+	if err != nil {
+		return err
+	}
+	jobs.RegisterDoer(d)
+	log.Print("registering job scheduler with ", c.Backend)
+	return nil
+}
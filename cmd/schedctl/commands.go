@@ -0,0 +1,227 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/betacraft/scheduler/jobs"
+	"github.com/betacraft/scheduler/queue/rmq"
+	"github.com/betacraft/scheduler/queue/sqs"
+	"github.com/betacraft/scheduler/store"
+)
+
+// setup lists the queues, they are declared on connecting
+func setup(c *settings) error {
+	return listQueues(c)
+}
+
+// enqueue fills up ID, EnqueueTime and ExecTime if not provided
+func enqueue(c *settings, args []string) error {
+	var r io.Reader = os.Stdin
+	if len(args) > 0 {
+		f, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	j := &jobs.Job{}
+	err := json.NewDecoder(r).Decode(j)
+	if err != nil {
+		return err
+	}
+	if len(c.JobTypes) == 0 {
+		jobs.RegisterType(j.Type)
+	}
+	for _, t := range c.JobTypes {
+		jobs.RegisterType(t)
+	}
+	now := jobs.Now()
+	if j.ID == "" {
+		b := make([]byte, 16)
+		_, err = rand.Read(b)
+		if err != nil {
+			return err
+		}
+		j.ID = hex.EncodeToString(b)
+	}
+	if j.EnqueueTime.IsZero() {
+		j.EnqueueTime = now
+	}
+	if j.ExecTime.IsZero() {
+		j.ExecTime = now.Add(time.Duration(j.Interval) * time.Millisecond)
+	}
+	err = jobs.Enqueue(j)
+	if err != nil {
+		return err
+	}
+	fmt.Println(j.ID)
+	return nil
+}
+
+func listQueues(c *settings) error {
+	queues, err := jobs.Queues()
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "REGION\tQUEUE\tMESSAGES")
+	for _, q := range queues {
+		region := q.Region
+		if region == "" {
+			region = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\n", region, q.Name, q.Messages)
+	}
+	return w.Flush()
+}
+
+func purge(c *settings, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: schedctl purge queue")
+	}
+	switch c.Config.Backend {
+	case "rmq":
+		n, err := rmq.PurgeQueue(args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Println("purged", n, "messages")
+		return nil
+	case "sqs":
+		region, err := sqsRegion(c, args[0])
+		if err != nil {
+			return err
+		}
+		err = sqs.PurgeQueue(region, args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Println("purge requested")
+		return nil
+	}
+	return fmt.Errorf("purge is not supported by the %s backend", c.Config.Backend)
+}
+
+func redrive(c *settings, args []string) error {
+	if len(args) != 2 {
+		return errors.New("usage: schedctl redrive from to")
+	}
+	var n int
+	var err error
+	switch c.Config.Backend {
+	case "rmq":
+		n, err = rmq.Redrive(args[0], c.Config.RMQ.Exchange, args[1])
+	case "sqs":
+		var region string
+		region, err = sqsRegion(c, args[1])
+		if err != nil {
+			return err
+		}
+		n, err = sqs.Redrive(region, args[0], args[1])
+	default:
+		return fmt.Errorf("redrive is not supported by the %s backend", c.Config.Backend)
+	}
+	if err != nil {
+		return fmt.Errorf("redrove %d messages before failing: %v", n, err)
+	}
+	fmt.Println("redrove", n, "messages")
+	return nil
+}
+
+// tail polls the store, and prints the records updated since the last poll
+func tail(c *settings) error {
+	if c.StoreDir == "" {
+		return errors.New("-store is required for tail")
+	}
+	s, err := store.NewFileStore(c.StoreDir)
+	if err != nil {
+		return err
+	}
+	seen := map[string]time.Time{}
+	first := true
+	for {
+		records, err := s.List()
+		if err != nil {
+			return err
+		}
+		for _, r := range records {
+			if !r.UpdatedAt.After(seen[r.Job.ID]) {
+				continue
+			}
+			seen[r.Job.ID] = r.UpdatedAt
+			if first { // print only the changes after starting
+				continue
+			}
+			fmt.Printf("%s %-9s %s %s %s\n", r.UpdatedAt.Format(time.RFC3339), r.Status, r.Job.Type, r.Job.ID, r.Error)
+		}
+		first = false
+		time.Sleep(time.Second)
+	}
+}
+
+// pauseStore is the redis server, if configured, or the file store
+func pauseStore(c *settings) (jobs.PauseStore, error) {
+	if c.PauseRedis != "" {
+		return store.NewRedisPauseStore(c.PauseRedis, "", 0), nil
+	}
+	if c.StoreDir == "" {
+		return nil, errors.New("-pause-redis or -store is required for pausing")
+	}
+	return store.NewFileStore(c.StoreDir)
+}
+
+func setPaused(c *settings, args []string, paused bool) error {
+	if len(args) != 2 || (args[0] != "queue" && args[0] != "type") {
+		return errors.New("expected queue or type, and its name")
+	}
+	s, err := pauseStore(c)
+	if err != nil {
+		return err
+	}
+	jobs.RegisterPauseStore(s)
+	switch {
+	case args[0] == "queue" && paused:
+		err = jobs.PauseQueue(args[1])
+	case args[0] == "queue":
+		err = jobs.ResumeQueue(args[1])
+	case paused:
+		err = jobs.PauseType(args[1])
+	default:
+		err = jobs.ResumeType(args[1])
+	}
+	return err
+}
+
+func listPaused(c *settings) error {
+	s, err := pauseStore(c)
+	if err != nil {
+		return err
+	}
+	jobs.RegisterPauseStore(s)
+	for _, q := range jobs.PausedQueues() {
+		fmt.Println("queue", q)
+	}
+	for _, t := range jobs.PausedTypes() {
+		fmt.Println("type ", t)
+	}
+	return nil
+}
+
+// region of the queue, from the configuration
+func sqsRegion(c *settings, queueName string) (string, error) {
+	for _, q := range c.Config.SQS.Queues {
+		if q.Name == queueName {
+			return q.Region, nil
+		}
+	}
+	return "", fmt.Errorf("queue %q not in the configuration", queueName)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/betacraft/scheduler/backend"
+	"github.com/betacraft/scheduler/config"
+)
+
+// settings of schedctl, the backend is configured with the config package
+type settings struct {
+	// path of the YAML or TOML file, the environment variables only if empty
+	ConfigPath string
+
+	// directory of the file job store, used by tail, and by pause and
+	// resume if PauseRedis is not set
+	StoreDir string
+
+	// address of the redis server keeping the paused queues and job types
+	PauseRedis string
+
+	// known job types, enqueue accepts any type if empty
+	JobTypes []string
+
+	// set by connect
+	Config *config.Config
+}
+
+func splitList(s string) []string {
+	list := []string{}
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// connect loads the configuration, and registers its backend, which
+// declares the queues in the configuration
+func connect(s *settings) error {
+	var c *config.Config
+	var err error
+	if s.ConfigPath != "" {
+		c, err = config.Load(s.ConfigPath)
+	} else {
+		c, err = config.FromEnv()
+	}
+	if err != nil {
+		return err
+	}
+	err = backend.Use(c)
+	if err != nil {
+		return err
+	}
+	s.Config = c
+	return nil
+}
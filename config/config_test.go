@@ -0,0 +1,85 @@
+package config
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func load(t *testing.T, name, content string) (*Config, error) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, name)
+	err = ioutil.WriteFile(path, []byte(content), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Load(path)
+}
+
+func TestLoad(t *testing.T) {
+	yml := "backend: memory\n"
+	tml := "backend = \"memory\"\n"
+	for name, content := range map[string]string{"c.yaml": yml, "c.toml": tml} {
+		c, err := load(t, name, content)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if c.Backend != "memory" {
+			t.Errorf("%s: got backend %q", name, c.Backend)
+		}
+	}
+}
+
+func TestLoadUnknownKeys(t *testing.T) {
+	yml := "backend: memory\nrmq:\n  exchnage: typo\n"
+	tml := "backend = \"memory\"\n[rmq]\nexchnage = \"typo\"\n"
+	for name, content := range map[string]string{"c.yaml": yml, "c.toml": tml} {
+		_, err := load(t, name, content)
+		if err == nil || !strings.Contains(err.Error(), "exchnage") {
+			t.Errorf("%s: got %v, want an error for the unknown key", name, err)
+		}
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	env := map[string]string{
+		"SCHEDULER_RMQ_CONFIRM_TIMEOUT":    "2000",
+		"SCHEDULER_RMQ_PUBLISH_CHANNELS":   "4",
+		"SCHEDULER_RMQ_PREFETCH":           "10",
+		"SCHEDULER_RMQ_DELAY_BUCKETS":      "1000, 60000",
+		"SCHEDULER_SQS_VISIBILITY_TIMEOUT": "120",
+		"SCHEDULER_SQS_WORKERS":            "3",
+	}
+	for k, v := range env {
+		os.Setenv(k, v)
+		defer os.Unsetenv(k)
+	}
+	c := &Config{}
+	if err := c.ApplyEnv(); err != nil {
+		t.Fatal(err)
+	}
+	if c.RMQ.ConfirmTimeout != 2000 || c.RMQ.PublishChannels != 4 || c.RMQ.Prefetch != 10 {
+		t.Errorf("got %+v", c.RMQ)
+	}
+	if len(c.RMQ.DelayBuckets) != 2 || c.RMQ.DelayBuckets[1] != 60000 {
+		t.Errorf("got delay buckets %v", c.RMQ.DelayBuckets)
+	}
+	if c.SQS.VisibilityTimeout != 120 || c.SQS.Workers != 3 {
+		t.Errorf("got %+v", c.SQS)
+	}
+
+	os.Setenv("SCHEDULER_SQS_WORKERS", "many")
+	err := c.ApplyEnv()
+	var cerr *Error
+	if !errors.As(err, &cerr) || cerr.Field != "sqs.workers" {
+		t.Errorf("got %v, want the invalid workers", err)
+	}
+}
@@ -0,0 +1,138 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/betacraft/scheduler/jobs"
+)
+
+// ApplyEnv overrides the configuration with the environment variables which
+// are set, the queues and delay buckets are lists separated by commas:
+//  SCHEDULER_BACKEND                 rmq, sqs or memory
+//  SCHEDULER_RMQ_URL
+//  SCHEDULER_RMQ_EXCHANGE
+//  SCHEDULER_RMQ_ACK_MODE
+//  SCHEDULER_RMQ_DELAY_STRATEGY
+//  SCHEDULER_RMQ_DELAY_BUCKETS       in milliseconds
+//  SCHEDULER_RMQ_CONFIRM_TIMEOUT     in milliseconds
+//  SCHEDULER_RMQ_PUBLISH_CHANNELS
+//  SCHEDULER_RMQ_PREFETCH
+//  SCHEDULER_RMQ_QUEUES              queue:routing_key[:dead_letter_queue],...
+//  SCHEDULER_SQS_ACCESS_KEY          AWS_ACCESS is used if not set
+//  SCHEDULER_SQS_SECRET_KEY          AWS_SECRET is used if not set
+//  SCHEDULER_SQS_VISIBILITY_TIMEOUT  in seconds
+//  SCHEDULER_SQS_WORKERS
+//  SCHEDULER_SQS_QUEUES              region:queue:delay[:dead_letter_queue],...
+// The rmq routes, and the exchanges of the queues, can only be set in a file.
+func (c *Config) ApplyEnv() error {
+	setFromEnv(&c.Backend, "SCHEDULER_BACKEND")
+	setFromEnv(&c.RMQ.URL, "SCHEDULER_RMQ_URL")
+	setFromEnv(&c.RMQ.Exchange, "SCHEDULER_RMQ_EXCHANGE")
+	setFromEnv(&c.RMQ.AckMode, "SCHEDULER_RMQ_ACK_MODE")
+	setFromEnv(&c.RMQ.DelayStrategy, "SCHEDULER_RMQ_DELAY_STRATEGY")
+	setFromEnv(&c.SQS.AccessKey, "AWS_ACCESS")
+	setFromEnv(&c.SQS.AccessKey, "SCHEDULER_SQS_ACCESS_KEY")
+	setFromEnv(&c.SQS.SecretKey, "AWS_SECRET")
+	setFromEnv(&c.SQS.SecretKey, "SCHEDULER_SQS_SECRET_KEY")
+
+	ints := []struct {
+		field *int
+		name  string
+		key   string
+	}{
+		{&c.RMQ.PublishChannels, "SCHEDULER_RMQ_PUBLISH_CHANNELS", "rmq.publish_channels"},
+		{&c.RMQ.Prefetch, "SCHEDULER_RMQ_PREFETCH", "rmq.prefetch"},
+		{&c.SQS.VisibilityTimeout, "SCHEDULER_SQS_VISIBILITY_TIMEOUT", "sqs.visibility_timeout"},
+		{&c.SQS.Workers, "SCHEDULER_SQS_WORKERS", "sqs.workers"},
+	}
+	for _, v := range ints {
+		if s := os.Getenv(v.name); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil {
+				return &Error{Field: v.key, Err: fmt.Errorf("%w: %q", jobs.ErrInvalidValue, s)}
+			}
+			*v.field = n
+		}
+	}
+	if v := os.Getenv("SCHEDULER_RMQ_CONFIRM_TIMEOUT"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return &Error{Field: "rmq.confirm_timeout", Err: fmt.Errorf("%w: %q", jobs.ErrInvalidValue, v)}
+		}
+		c.RMQ.ConfirmTimeout = n
+	}
+	if v := os.Getenv("SCHEDULER_RMQ_DELAY_BUCKETS"); v != "" {
+		buckets := []int64{}
+		for _, b := range strings.Split(v, ",") {
+			n, err := strconv.ParseInt(strings.TrimSpace(b), 10, 64)
+			if err != nil {
+				return &Error{Field: "rmq.delay_buckets", Err: fmt.Errorf("%w: %q", jobs.ErrInvalidValue, b)}
+			}
+			buckets = append(buckets, n)
+		}
+		c.RMQ.DelayBuckets = buckets
+	}
+
+	if v := os.Getenv("SCHEDULER_RMQ_QUEUES"); v != "" {
+		queues, err := ParseRMQQueues(v)
+		if err != nil {
+			return err
+		}
+		c.RMQ.Queues = queues
+	}
+	if v := os.Getenv("SCHEDULER_SQS_QUEUES"); v != "" {
+		queues, err := ParseSQSQueues(v)
+		if err != nil {
+			return err
+		}
+		c.SQS.Queues = queues
+	}
+	return nil
+}
+
+func setFromEnv(field *string, name string) {
+	if v := os.Getenv(name); v != "" {
+		*field = v
+	}
+}
+
+// ParseRMQQueues parses queue:routing_key[:dead_letter_queue],...
+func ParseRMQQueues(s string) ([]RMQQueue, error) {
+	queues := []RMQQueue{}
+	for _, v := range strings.Split(s, ",") {
+		parts := strings.Split(strings.TrimSpace(v), ":")
+		if len(parts) < 2 || len(parts) > 3 {
+			return nil, &Error{Field: "rmq.queues", Err: fmt.Errorf("%q, expected queue:routing_key[:dead_letter_queue]", v)}
+		}
+		q := RMQQueue{Name: parts[0], RoutingKey: parts[1]}
+		if len(parts) == 3 {
+			q.DeadLetterQueue = parts[2]
+		}
+		queues = append(queues, q)
+	}
+	return queues, nil
+}
+
+// ParseSQSQueues parses region:queue:delay[:dead_letter_queue],...
+func ParseSQSQueues(s string) ([]SQSQueue, error) {
+	queues := []SQSQueue{}
+	for _, v := range strings.Split(s, ",") {
+		parts := strings.Split(strings.TrimSpace(v), ":")
+		if len(parts) < 3 || len(parts) > 4 {
+			return nil, &Error{Field: "sqs.queues", Err: fmt.Errorf("%q, expected region:queue:delay[:dead_letter_queue]", v)}
+		}
+		delay, err := strconv.Atoi(parts[2])
+		if err != nil {
+			return nil, &Error{Field: "sqs.queues", Err: fmt.Errorf("%q, invalid delay: %v", v, err)}
+		}
+		q := SQSQueue{Region: parts[0], Name: parts[1], Delay: delay}
+		if len(parts) == 4 {
+			q.DeadLetterQueue = parts[3]
+		}
+		queues = append(queues, q)
+	}
+	return queues, nil
+}
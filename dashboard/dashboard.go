@@ -0,0 +1,42 @@
+// Package dashboard provides a self contained web UI for the scheduler,
+// showing the queues, the scheduled and recurring jobs, the recent failures
+// and the throughput per job type, with buttons to retry and cancel jobs.
+// The static assets are embedded in the binary, and the data is served by
+// the admin package under api/.
+//
+// The buttons act on any job or queue, so as the admin handler, the dashboard
+// must be mounted behind authentication, or be passed an admin.Authorizer.
+// The dashboard sets the X-Requested-With header the admin handler requires
+// on the requests other than GET.
+//
+// Mount it into an existing server with http.StripPrefix, for eg:
+//  http.Handle("/scheduler/", http.StripPrefix("/scheduler", dashboard.NewHandler()))
+package dashboard
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+
+	"github.com/betacraft/scheduler/admin"
+)
+
+//go:embed static
+var assets embed.FS
+
+// CSRFHeader is the header the api requires, with any value,
+// on the requests other than GET and HEAD
+const CSRFHeader = admin.CSRFHeader
+
+// NewHandler returns the dashboard handler, it needs a job store registered
+// with jobs.RegisterStore, the options are passed to admin.NewHandler
+func NewHandler(opts ...admin.Option) http.Handler {
+	static, err := fs.Sub(assets, "static")
+	if err != nil { // only if the embed directive above is broken
+		panic(err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/api/", http.StripPrefix("/api", admin.NewHandler(opts...)))
+	mux.Handle("/", http.FileServer(http.FS(static)))
+	return mux
+}
@@ -0,0 +1,40 @@
+package dashboard
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequireHeader(t *testing.T) {
+	h := NewHandler()
+	cases := []struct {
+		method, path string
+		header       bool
+		code         int
+	}{
+		{"GET", "/api/executors", false, http.StatusOK},
+		{"POST", "/api/queues/q/pause", false, http.StatusForbidden},
+		{"DELETE", "/api/jobs/1", false, http.StatusForbidden},
+		{"POST", "/api/nothing", true, http.StatusNotFound}, // reaches the admin handler
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest(c.method, c.path, nil)
+		if c.header {
+			r.Header.Set(CSRFHeader, "test")
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != c.code {
+			t.Errorf("%s %s got %d, want %d", c.method, c.path, w.Code, c.code)
+		}
+	}
+}
+
+func TestIndex(t *testing.T) {
+	w := httptest.NewRecorder()
+	NewHandler().ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("got %d, want %d", w.Code, http.StatusOK)
+	}
+}
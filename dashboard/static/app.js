@@ -0,0 +1,165 @@
+// Dashboard for the scheduler, polls the admin api every few seconds.
+(function () {
+  "use strict";
+
+  var REFRESH = 5000;
+
+  function api(method, path) {
+    // the api refuses the requests changing anything without the header,
+    // which cross site forms can't set
+    var headers = { "X-Requested-With": "scheduler-dashboard" };
+    return fetch("api/" + path, { method: method, headers: headers }).then(function (res) {
+      return res.json().then(function (body) {
+        if (!res.ok) {
+          throw new Error(body.error || res.statusText);
+        }
+        return body;
+      });
+    });
+  }
+
+  function el(tag, attrs, children) {
+    var e = document.createElement(tag);
+    Object.keys(attrs || {}).forEach(function (k) {
+      if (k === "onclick") {
+        e.onclick = attrs[k];
+      } else {
+        e.setAttribute(k, attrs[k]);
+      }
+    });
+    (children || []).forEach(function (c) {
+      e.appendChild(typeof c === "string" ? document.createTextNode(c) : c);
+    });
+    return e;
+  }
+
+  function fill(id, rows, columns, empty) {
+    var body = document.querySelector("#" + id + " tbody");
+    body.innerHTML = "";
+    if (rows.length === 0) {
+      body.appendChild(el("tr", {}, [el("td", { colspan: columns, class: "empty" }, [empty])]));
+      return;
+    }
+    rows.forEach(function (r) { body.appendChild(r); });
+  }
+
+  function time(t) {
+    return t ? new Date(t).toLocaleString() : "";
+  }
+
+  function action(label, method, path) {
+    return el("button", {
+      onclick: function () {
+        api(method, path).then(refresh, function (err) { alert(err.message); });
+      }
+    }, [label]);
+  }
+
+  function renderQueues(queues) {
+    fill("queues", queues.map(function (q) {
+      var name = encodeURIComponent(q.name);
+      return el("tr", {}, [
+        el("td", {}, [q.region || "-"]),
+        el("td", {}, [q.name]),
+        el("td", {}, [String(q.messages)]),
+        el("td", {}, [q.paused ? "paused" : "consuming"]),
+        el("td", {}, [q.paused ? action("Resume", "POST", "queues/" + name + "/resume")
+                               : action("Pause", "POST", "queues/" + name + "/pause")])
+      ]);
+    }), 5, "No queues");
+  }
+
+  function renderJobs(records) {
+    var scheduled = records.filter(function (r) {
+      return r.status === "scheduled" || r.status === "running";
+    });
+    scheduled.sort(function (a, b) { return new Date(a.job.exec_time) - new Date(b.job.exec_time); });
+    fill("scheduled", scheduled.map(function (r) {
+      var id = encodeURIComponent(r.job.id);
+      return el("tr", {}, [
+        el("td", {}, [r.job.id]),
+        el("td", {}, [r.job.type]),
+        el("td", {}, [r.job.queue]),
+        el("td", {}, [r.status === "running" && r.progress ? "running " + r.progress + "% " + (r.progress_message || "") : r.status]),
+        el("td", {}, [r.job.is_recurring ? "every " + r.job.interval / 1000 + "s" : "no"]),
+        el("td", {}, [time(r.job.exec_time)]),
+        el("td", {}, [action("Cancel", "POST", "jobs/" + id + "/cancel")])
+      ]);
+    }), 7, "No scheduled jobs");
+
+    // by the last run, recurring jobs are scheduled again once they fail
+    var failures = records.filter(function (r) { return r.last_status === "failed" || r.last_status === "dead"; });
+    failures.sort(function (a, b) { return new Date(b.last_run_at) - new Date(a.last_run_at); });
+    fill("failures", failures.slice(0, 50).map(function (r) {
+      var id = encodeURIComponent(r.job.id);
+      return el("tr", {}, [
+        el("td", {}, [r.job.id]),
+        el("td", {}, [r.job.type]),
+        el("td", {}, [r.job.queue]),
+        el("td", {}, [time(r.last_run_at)]),
+        el("td", { class: "error" }, [r.last_error || ""]),
+        // a job scheduled again is retried on its own
+        el("td", {}, r.status === "failed" || r.status === "dead" ?
+          [action("Retry", "POST", "jobs/" + id + "/retry")] : [r.status])
+      ]);
+    }), 6, "No failures");
+  }
+
+  var SVG = "http://www.w3.org/2000/svg";
+
+  // stacked bars, succeeded at the bottom and failed on top
+  function chart(stats) {
+    var n = stats.succeeded.length, max = 1;
+    for (var i = 0; i < n; i++) {
+      max = Math.max(max, stats.succeeded[i] + stats.failed[i]);
+    }
+    var svg = document.createElementNS(SVG, "svg");
+    svg.setAttribute("viewBox", "0 0 " + n + " 100");
+    svg.setAttribute("preserveAspectRatio", "none");
+    for (i = 0; i < n; i++) {
+      var s = stats.succeeded[i] / max * 100, f = stats.failed[i] / max * 100;
+      [[s, 100 - s, "succeeded"], [f, 100 - s - f, "failed"]].forEach(function (b) {
+        if (b[0] === 0) {
+          return;
+        }
+        var rect = document.createElementNS(SVG, "rect");
+        rect.setAttribute("x", i + 0.1);
+        rect.setAttribute("y", b[1]);
+        rect.setAttribute("width", 0.8);
+        rect.setAttribute("height", b[0]);
+        rect.setAttribute("class", b[2]);
+        svg.appendChild(rect);
+      });
+    }
+    var counts = Object.keys(stats.counts).sort().map(function (k) {
+      return k + ": " + stats.counts[k];
+    }).join(", ");
+    return el("div", { class: "chart" }, [
+      el("h3", {}, [stats.type + " (peak " + max + "/min)"]), svg, el("div", { class: "counts" }, [counts])
+    ]);
+  }
+
+  function renderStats(stats) {
+    var charts = document.getElementById("charts");
+    charts.innerHTML = "";
+    stats.forEach(function (s) { charts.appendChild(chart(s)); });
+    if (stats.length === 0) {
+      charts.appendChild(el("p", { class: "counts" }, ["No jobs in the store"]));
+    }
+  }
+
+  function refresh() {
+    return Promise.all([
+      api("GET", "queues").then(renderQueues, function () { renderQueues([]); }),
+      api("GET", "jobs").then(renderJobs),
+      api("GET", "stats").then(renderStats)
+    ]).then(function () {
+      document.getElementById("updated").textContent = "updated " + new Date().toLocaleTimeString();
+    }, function (err) {
+      document.getElementById("updated").textContent = "error: " + err.message;
+    });
+  }
+
+  refresh();
+  setInterval(refresh, REFRESH);
+})();
@@ -1,3 +1,8 @@
+//go:build ignore
+// +build ignore
+
+// Run with: go run examples/sqs_consumer.go
+
 package main
 
 import (
@@ -1,3 +1,8 @@
+//go:build ignore
+// +build ignore
+
+// Run with: go run examples/sqs_publisher.go
+
 package main
 
 import (
@@ -21,6 +26,9 @@ func main() {
 	// Init SQS SDK with creds
 	sqs.InitSQSRegions(awsAccess, awsSecret)
 
+	// The executor is registered in the consumer, make the job type known here
+	jobs.RegisterType("CustomerExecutor")
+
 	// Setup queue, with minimum delay i.e '0' second
 	sqsConf := sqs.NewSQSConfig("APSoutheast", "test-queue", sqs.MIN_QUEUE_DELAY)
 	err := sqs.Setup(sqsConf)
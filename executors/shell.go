@@ -0,0 +1,232 @@
+package executors
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/betacraft/scheduler/jobs"
+)
+
+// ShellType is the job type RegisterShell registers the shell executor with
+const ShellType = "Shell"
+
+// at most these many bytes of stdout and of stderr are kept in the result
+const maxShellOutput = 16384
+
+// Shell runs a command, its fields are filled from the JobData:
+//  {"command": "/usr/local/bin/cleanup", "args": ["--days", "7"],
+//   "env": {"LOG_LEVEL": "debug"}, "dir": "/var/lib/app", "timeout": 600000}
+//
+// The command runs in a process group of its own, which is killed when
+// the job is cancelled, or the timeout passes.
+//
+// The JobData comes from whoever can enqueue jobs, including through the
+// admin API, so only the commands allowed by the ShellPolicy passed to
+// RegisterShell are run, and the others are permanent errors. Allow only
+// commands which are safe to run with any arguments, i.e. not shells or
+// interpreters.
+type Shell struct {
+	Command string   `json:"command"`
+	Args    []string `json:"args"`
+
+	// Added to the environment of the worker process
+	Env map[string]string `json:"env"`
+
+	// Working directory, that of the worker process if empty
+	Dir string `json:"dir"`
+
+	// Timeout in milliseconds, no timeout if 0
+	Timeout int64 `json:"timeout"`
+
+	// Exit codes which mean success, only 0 by default
+	SuccessExitCodes []int `json:"success_exit_codes"`
+
+	// Exit codes for which the job is retried after RetryDelay
+	RetryExitCodes []int `json:"retry_exit_codes"`
+
+	// Delay before retrying in milliseconds, 1 minute by default
+	RetryDelay int64 `json:"retry_delay"`
+
+	policy ShellPolicy
+}
+
+// ShellPolicy limits what the shell jobs can run
+type ShellPolicy struct {
+	// Commands the jobs may run, matched against Shell.Command as is,
+	// use absolute paths. No command is run if empty.
+	Commands []string
+
+	// Whether the jobs may set environment variables, which can change
+	// what an allowed command does, for eg: LD_PRELOAD
+	AllowEnv bool
+
+	// Whether the jobs may set the working directory
+	AllowDir bool
+}
+
+// Returned, as a permanent error, for the jobs not allowed by the ShellPolicy
+var ErrNotAllowed = errors.New("not allowed by the shell policy")
+
+func (p ShellPolicy) check(s *Shell) error {
+	switch {
+	case !containsString(p.Commands, s.Command):
+		return fmt.Errorf("command %s: %w", s.Command, ErrNotAllowed)
+	case len(s.Env) > 0 && !p.AllowEnv:
+		return fmt.Errorf("env: %w", ErrNotAllowed)
+	case s.Dir != "" && !p.AllowDir:
+		return fmt.Errorf("dir: %w", ErrNotAllowed)
+	}
+	return nil
+}
+
+// ShellResult is saved as the result of the job
+type ShellResult struct {
+	ExitCode int `json:"exit_code"`
+
+	// Output of the command, truncated
+	Stdout string `json:"stdout"`
+	Stderr string `json:"stderr"`
+
+	// Time taken by the command in milliseconds
+	Duration int64 `json:"duration"`
+}
+
+// RegisterShell registers the shell executor for ShellType,
+// running only what the policy allows
+func RegisterShell(p ShellPolicy) {
+	jobs.RegisterExecutor(ShellType, &Shell{policy: p})
+}
+
+func (s *Shell) New() jobs.Executor {
+	return &Shell{policy: s.policy}
+}
+
+func (s *Shell) Execute(j *jobs.Job) error {
+	_, err := s.ExecuteResult(j)
+	return err
+}
+
+func (s *Shell) ExecuteResult(j *jobs.Job) (interface{}, error) {
+	if s.Command == "" {
+		return nil, jobs.Permanent(errors.New("shell command missing"))
+	}
+	err := s.policy.check(s)
+	if err != nil {
+		return nil, jobs.Permanent(err)
+	}
+	ctx, cancel := j.Context(), context.CancelFunc(func() {})
+	if s.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(s.Timeout)*time.Millisecond)
+	}
+	defer cancel()
+
+	cmd := exec.Command(s.Command, s.Args...)
+	cmd.Dir = s.Dir
+	cmd.Env = os.Environ()
+	for k, v := range s.Env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	stdout := &limitedBuffer{max: maxShellOutput}
+	stderr := &limitedBuffer{max: maxShellOutput}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	setProcessGroup(cmd)
+
+	start := time.Now()
+	err = cmd.Start()
+	if err != nil { // not found, not executable ...
+		return nil, jobs.Permanent(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		killProcessGroup(cmd)
+		err = <-done
+	}
+
+	result := &ShellResult{
+		ExitCode: -1,
+		Stdout:   stdout.String(),
+		Stderr:   stderr.String(),
+		Duration: int64(time.Since(start) / time.Millisecond),
+	}
+	if cmd.ProcessState != nil {
+		result.ExitCode = cmd.ProcessState.ExitCode()
+	}
+	if j.Context().Err() != nil { // cancelled, not timed out
+		return result, jobs.ErrCancelled
+	}
+	if ctx.Err() != nil {
+		return result, fmt.Errorf("command %s killed: %v", s.Command, ctx.Err())
+	}
+	if contains(s.SuccessExitCodes, result.ExitCode) || (len(s.SuccessExitCodes) == 0 && err == nil) {
+		return result, nil
+	}
+	if err == nil {
+		err = fmt.Errorf("command %s exited with %d", s.Command, result.ExitCode)
+	}
+	if contains(s.RetryExitCodes, result.ExitCode) {
+		delay := time.Minute
+		if s.RetryDelay > 0 {
+			delay = time.Duration(s.RetryDelay) * time.Millisecond
+		}
+		return result, jobs.RetryAfter(err, delay)
+	}
+	return result, err
+}
+
+func containsString(list []string, v string) bool {
+	for _, x := range list {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []int, v int) bool {
+	for _, x := range list {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+// limitedBuffer keeps the first max bytes written to it, and drops the rest
+type limitedBuffer struct {
+	mu        sync.Mutex
+	max       int
+	buf       []byte
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	n := b.max - len(b.buf)
+	if n > len(p) {
+		n = len(p)
+	}
+	if n < len(p) {
+		b.truncated = true
+	}
+	b.buf = append(b.buf, p[:n]...)
+	return len(p), nil
+}
+
+func (b *limitedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.truncated {
+		return string(b.buf) + "\n[truncated]"
+	}
+	return string(b.buf)
+}
@@ -0,0 +1,18 @@
+//go:build !unix
+// +build !unix
+
+package executors
+
+import "os/exec"
+
+// process groups are not supported, or not with the same
+// syscalls, only the command is killed
+
+func setProcessGroup(cmd *exec.Cmd) {}
+
+func killProcessGroup(cmd *exec.Cmd) {
+	if cmd.Process == nil {
+		return
+	}
+	cmd.Process.Kill()
+}
@@ -0,0 +1,136 @@
+//go:build unix
+// +build unix
+
+package executors
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/betacraft/scheduler/jobs"
+	"github.com/betacraft/scheduler/store"
+)
+
+const sh = "/bin/sh"
+
+func shellJob(p ShellPolicy, s Shell) *jobs.Job {
+	RegisterShell(p)
+	return &jobs.Job{ID: "shell", Type: ShellType, JobData: s}
+}
+
+func TestShellExitCodes(t *testing.T) {
+	p := ShellPolicy{Commands: []string{sh}}
+	cases := []struct {
+		script  string
+		success []int
+		retry   []int
+		action  jobs.Action
+	}{
+		{"exit 0", nil, nil, jobs.ActionDone},
+		{"exit 3", nil, nil, jobs.ActionDone}, // a plain failure, not recurring
+		{"exit 3", []int{0, 3}, nil, jobs.ActionDone},
+		{"exit 75", nil, []int{75}, jobs.ActionRetry},
+	}
+	for _, c := range cases {
+		j := shellJob(p, Shell{Command: sh, Args: []string{"-c", c.script}, SuccessExitCodes: c.success, RetryExitCodes: c.retry})
+		action, err := jobs.Process(j)
+		if action != c.action {
+			t.Errorf("%s: got %s, %v, want %s", c.script, action, err, c.action)
+		}
+		wantErr := c.script != "exit 0" && len(c.success) == 0
+		if (err != nil) != wantErr {
+			t.Errorf("%s: got error %v", c.script, err)
+		}
+	}
+}
+
+func TestShellResult(t *testing.T) {
+	s := &Shell{Command: sh, Args: []string{"-c", `echo "$GREETING"; echo oops >&2; exit 4`}, Env: map[string]string{"GREETING": "hello"}}
+	s.policy = ShellPolicy{Commands: []string{sh}, AllowEnv: true}
+	r, err := s.ExecuteResult(&jobs.Job{ID: "result", Type: ShellType})
+	if err == nil {
+		t.Error("no error for exit code 4")
+	}
+	res := r.(*ShellResult)
+	if res.ExitCode != 4 || res.Stdout != "hello\n" || res.Stderr != "oops\n" {
+		t.Errorf("got %+v", res)
+	}
+}
+
+func TestShellPolicy(t *testing.T) {
+	p := ShellPolicy{Commands: []string{"/bin/true"}}
+	cases := []Shell{
+		{Command: sh, Args: []string{"-c", "true"}},
+		{Command: "true"}, // matched as is, not looked up in PATH
+		{Command: "/bin/true", Env: map[string]string{"LD_PRELOAD": "/tmp/x.so"}},
+		{Command: "/bin/true", Dir: "/tmp"},
+	}
+	for _, s := range cases {
+		action, err := jobs.Process(shellJob(p, s))
+		if action != jobs.ActionDeadLetter || !errors.Is(err, ErrNotAllowed) {
+			t.Errorf("%+v: got %s, %v, want dead-lettered as not allowed", s, action, err)
+		}
+	}
+	p.AllowEnv, p.AllowDir = true, true
+	for _, s := range cases[2:] {
+		if action, err := jobs.Process(shellJob(p, s)); action != jobs.ActionDone || err != nil {
+			t.Errorf("%+v: got %s, %v", s, action, err)
+		}
+	}
+}
+
+func TestShellTimeoutKillsGroup(t *testing.T) {
+	// the background sleep keeps the output pipe open, the command returns
+	// before it ends only if the whole process group is killed
+	j := shellJob(ShellPolicy{Commands: []string{sh}}, Shell{Command: sh, Args: []string{"-c", "sleep 30 & wait"}, Timeout: 200})
+	start := time.Now()
+	action, err := jobs.Process(j)
+	if d := time.Since(start); d > 10*time.Second {
+		t.Fatalf("took %v, the process group was not killed", d)
+	}
+	if err == nil || action != jobs.ActionDone {
+		t.Errorf("got %s, %v, want the killed command failed", action, err)
+	}
+}
+
+func TestShellCancelled(t *testing.T) {
+	defer func(d time.Duration) { jobs.HeartbeatInterval = d }(jobs.HeartbeatInterval)
+	jobs.HeartbeatInterval = 10 * time.Millisecond
+	s := store.NewMemoryStore()
+	jobs.RegisterStore(s)
+	defer jobs.RegisterStore(nil)
+
+	j := shellJob(ShellPolicy{Commands: []string{sh}}, Shell{Command: sh, Args: []string{"-c", "sleep 30"}})
+	err := s.Save(&jobs.Record{Job: j, Status: jobs.StatusScheduled})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		jobs.Cancel(j.ID)
+	}()
+	action, err := jobs.Process(j)
+	if action != jobs.ActionDrop || err != jobs.ErrCancelled {
+		t.Errorf("got %s, %v, want the cancelled job dropped", action, err)
+	}
+}
+
+func TestShellStartFailure(t *testing.T) {
+	missing := "/nonexistent/command"
+	action, _ := jobs.Process(shellJob(ShellPolicy{Commands: []string{missing}}, Shell{Command: missing}))
+	if action != jobs.ActionDeadLetter {
+		t.Errorf("got %s, want dead-letter", action)
+	}
+}
+
+func TestLimitedBuffer(t *testing.T) {
+	b := &limitedBuffer{max: 4}
+	n, err := b.Write([]byte("abcdef"))
+	if n != 6 || err != nil {
+		t.Errorf("wrote %d, %v", n, err)
+	}
+	if got := b.String(); got != "abcd\n[truncated]" {
+		t.Errorf("got %q", got)
+	}
+}
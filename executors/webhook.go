@@ -0,0 +1,203 @@
+// Package executors has the built-in executors, which can be registered
+// with the jobs package for the common kinds of jobs.
+package executors
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/betacraft/scheduler/jobs"
+)
+
+// WebhookType is the job type RegisterWebhook registers the webhook executor with
+const WebhookType = "Webhook"
+
+// at most these many bytes of the response body are kept in the result
+const maxWebhookBody = 4096
+
+// Webhook calls an http endpoint, its fields are filled from the JobData:
+//  {"method": "POST", "url": "https://example.com/hooks/cleanup",
+//   "headers": {"Authorization": "Bearer token"}, "body": {"days": 7},
+//   "timeout": 10000, "expected_status": [200, 202]}
+//
+// A response with a status not expected is a permanent error, except for
+// 408, 429 and 5xx responses, which are retried, like network errors,
+// till MaxAttempts.
+type Webhook struct {
+	// GET by default, POST if Body is set
+	Method string `json:"method"`
+
+	URL string `json:"url"`
+
+	Headers map[string]string `json:"headers"`
+
+	// Sent as is if it is a json string, else as json, with the
+	// Content-Type set to application/json if not in Headers
+	Body json.RawMessage `json:"body"`
+
+	// Timeout of the request in milliseconds, 30 seconds by default
+	Timeout int64 `json:"timeout"`
+
+	// Status codes of a successful response, any 2xx by default
+	ExpectedStatus []int `json:"expected_status"`
+
+	// Delay before retrying in milliseconds, 1 minute by default,
+	// the Retry-After header of the response takes precedence
+	RetryDelay int64 `json:"retry_delay"`
+
+	// Attempts after which a retryable failure becomes permanent, 5 by default
+	MaxAttempts int `json:"max_attempts"`
+
+	// Client used for the requests, http.DefaultClient if nil
+	Client *http.Client `json:"-"`
+}
+
+// WebhookResult is saved as the result of the job
+type WebhookResult struct {
+	Status int `json:"status"`
+
+	// Time taken by the request in milliseconds
+	Latency int64 `json:"latency"`
+
+	// Response body, truncated
+	Body string `json:"body"`
+}
+
+// RegisterWebhook registers the webhook executor for WebhookType,
+// client may be nil
+func RegisterWebhook(client *http.Client) {
+	jobs.RegisterExecutor(WebhookType, &Webhook{Client: client})
+}
+
+func (w *Webhook) New() jobs.Executor {
+	return &Webhook{Client: w.Client}
+}
+
+func (w *Webhook) Execute(j *jobs.Job) error {
+	_, err := w.ExecuteResult(j)
+	return err
+}
+
+func (w *Webhook) ExecuteResult(j *jobs.Job) (interface{}, error) {
+	req, cancel, err := w.request(j)
+	if err != nil {
+		return nil, jobs.Permanent(err)
+	}
+	defer cancel()
+	client := w.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	start := time.Now()
+	res, err := client.Do(req)
+	if err != nil {
+		if j.Context().Err() != nil { // cancelled, not timed out
+			return nil, jobs.ErrCancelled
+		}
+		return nil, w.retry(j, err, nil)
+	}
+	defer res.Body.Close()
+	body, _ := ioutil.ReadAll(io.LimitReader(res.Body, maxWebhookBody))
+	result := &WebhookResult{
+		Status:  res.StatusCode,
+		Latency: int64(time.Since(start) / time.Millisecond),
+		Body:    string(body),
+	}
+
+	if w.expected(res.StatusCode) {
+		return result, nil
+	}
+	err = fmt.Errorf("webhook %s %s: unexpected status %d", req.Method, w.URL, res.StatusCode)
+	switch {
+	case res.StatusCode == http.StatusRequestTimeout,
+		res.StatusCode == http.StatusTooManyRequests,
+		res.StatusCode >= 500:
+		return result, w.retry(j, err, res)
+	}
+	return result, jobs.Permanent(err)
+}
+
+// request is made with the context of the job, so that cancelling
+// the job cancels the request too, and the job is dropped
+func (w *Webhook) request(j *jobs.Job) (*http.Request, context.CancelFunc, error) {
+	if w.URL == "" {
+		return nil, nil, errors.New("webhook url missing")
+	}
+	method := w.Method
+	var body io.Reader
+	isJSON := false
+	if len(w.Body) > 0 && string(w.Body) != "null" {
+		var s string
+		if json.Unmarshal(w.Body, &s) == nil {
+			body = bytes.NewBufferString(s)
+		} else {
+			body = bytes.NewReader(w.Body)
+			isJSON = true
+		}
+		if method == "" {
+			method = "POST"
+		}
+	}
+	if method == "" {
+		method = "GET"
+	}
+	timeout := 30 * time.Second
+	if w.Timeout > 0 {
+		timeout = time.Duration(w.Timeout) * time.Millisecond
+	}
+	req, err := http.NewRequest(method, w.URL, body)
+	if err != nil {
+		return nil, nil, err
+	}
+	ctx, cancel := context.WithTimeout(j.Context(), timeout)
+	req = req.WithContext(ctx)
+	for k, v := range w.Headers {
+		req.Header.Set(k, v)
+	}
+	if isJSON && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req, cancel, nil
+}
+
+func (w *Webhook) expected(status int) bool {
+	if len(w.ExpectedStatus) == 0 {
+		return status >= 200 && status < 300
+	}
+	for _, v := range w.ExpectedStatus {
+		if v == status {
+			return true
+		}
+	}
+	return false
+}
+
+// retry returns err as retryable, unless the attempts are exhausted
+func (w *Webhook) retry(j *jobs.Job, err error, res *http.Response) error {
+	max := w.MaxAttempts
+	if max <= 0 {
+		max = 5
+	}
+	if j.Attempts+1 >= max {
+		return jobs.Permanent(fmt.Errorf("giving up after %d attempts: %v", j.Attempts+1, err))
+	}
+	delay := time.Minute
+	if w.RetryDelay > 0 {
+		delay = time.Duration(w.RetryDelay) * time.Millisecond
+	}
+	if res != nil {
+		if secs, err := strconv.Atoi(res.Header.Get("Retry-After")); err == nil && secs >= 0 {
+			delay = time.Duration(secs) * time.Second
+		}
+	}
+	return jobs.RetryAfter(err, delay)
+}
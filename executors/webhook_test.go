@@ -0,0 +1,121 @@
+package executors
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/betacraft/scheduler/jobs"
+	"github.com/betacraft/scheduler/store"
+)
+
+func webhookJob(data map[string]interface{}) *jobs.Job {
+	RegisterWebhook(nil)
+	return &jobs.Job{ID: "hook", Type: WebhookType, JobData: data}
+}
+
+func TestWebhookSuccess(t *testing.T) {
+	var got struct {
+		method, contentType, auth string
+		body                      map[string]int
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got.method = r.Method
+		got.contentType = r.Header.Get("Content-Type")
+		got.auth = r.Header.Get("Authorization")
+		b, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(b, &got.body)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	j := webhookJob(map[string]interface{}{
+		"url":     srv.URL,
+		"headers": map[string]string{"Authorization": "Bearer token"},
+		"body":    map[string]int{"days": 7},
+	})
+	action, err := jobs.Process(j)
+	if err != nil || action != jobs.ActionDone {
+		t.Fatalf("got %s, %v", action, err)
+	}
+	if got.method != "POST" || got.contentType != "application/json" || got.auth != "Bearer token" || got.body["days"] != 7 {
+		t.Errorf("unexpected request %+v", got)
+	}
+}
+
+func TestWebhookStatus(t *testing.T) {
+	status := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "120")
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	cases := []struct {
+		status   int
+		attempts int
+		action   jobs.Action
+	}{
+		{http.StatusOK, 0, jobs.ActionDone},
+		{http.StatusNotFound, 0, jobs.ActionDeadLetter},
+		{http.StatusTooManyRequests, 0, jobs.ActionRetry},
+		{http.StatusBadGateway, 0, jobs.ActionRetry},
+		{http.StatusBadGateway, 4, jobs.ActionDeadLetter}, // 5th attempt
+	}
+	for _, c := range cases {
+		status = c.status
+		j := webhookJob(map[string]interface{}{"url": srv.URL})
+		j.Attempts = c.attempts
+		before := jobs.Now()
+		action, _ := jobs.Process(j)
+		if action != c.action {
+			t.Errorf("%d after %d attempts: got %s, want %s", c.status, c.attempts, action, c.action)
+		}
+		if action == jobs.ActionRetry && j.ExecTime.Before(before.Add(2*time.Minute)) {
+			t.Errorf("%d: retried at %v, want after the Retry-After of 2 minutes", c.status, j.ExecTime)
+		}
+	}
+}
+
+func TestWebhookTimeout(t *testing.T) {
+	done := make(chan bool)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer srv.Close()
+	defer close(done)
+
+	j := webhookJob(map[string]interface{}{"url": srv.URL, "timeout": 50})
+	action, err := jobs.Process(j)
+	if action != jobs.ActionRetry {
+		t.Errorf("got %s, %v, want retry", action, err)
+	}
+}
+
+func TestWebhookCancelled(t *testing.T) {
+	defer func(d time.Duration) { jobs.HeartbeatInterval = d }(jobs.HeartbeatInterval)
+	jobs.HeartbeatInterval = 10 * time.Millisecond
+	s := store.NewMemoryStore()
+	jobs.RegisterStore(s)
+	defer jobs.RegisterStore(nil)
+
+	j := webhookJob(nil)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		jobs.Cancel(j.ID)
+		<-r.Context().Done() // till the heartbeat notices the cancellation
+	}))
+	defer srv.Close()
+	j.JobData = map[string]interface{}{"url": srv.URL}
+	err := s.Save(&jobs.Record{Job: j, Status: jobs.StatusScheduled})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	action, err := jobs.Process(j)
+	if action != jobs.ActionDrop || err != jobs.ErrCancelled {
+		t.Errorf("got %s, %v, want the cancelled job dropped", action, err)
+	}
+}
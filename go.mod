@@ -0,0 +1,10 @@
+module github.com/betacraft/scheduler
+
+go 1.19
+
+require (
+	github.com/BurntSushi/toml v1.6.0
+	github.com/pborman/uuid v0.0.0-20170612153648-e790cca94e6c
+	github.com/streadway/amqp v0.0.0-20180528204448-e5adc2ada8b8
+	gopkg.in/yaml.v2 v2.4.0
+)
@@ -0,0 +1,167 @@
+// Package resp is a minimal client for servers speaking the Redis
+// serialization protocol (Redis, Valkey, KeyDB, Dragonfly ...). It only
+// supports what the scheduler needs, i.e. sending a command and reading
+// back a single reply.
+package resp
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrNil is returned by Do when the server replies with a nil bulk string
+// or a nil array, e.g. GET on a missing key.
+var ErrNil = errors.New("resp: nil reply")
+
+// Error is an error reply sent by the server.
+type Error string
+
+func (e Error) Error() string { return string(e) }
+
+// Client is safe to be used from multiple goroutines, commands are
+// serialized over a single connection which is re-dialed when broken.
+type Client struct {
+	Addr     string
+	Password string
+	DB       int
+	Timeout  time.Duration
+
+	mu   sync.Mutex
+	conn net.Conn
+	rd   *bufio.Reader
+}
+
+// NewClient returns a client for addr (host:port), the connection is made
+// lazily on the first command.
+func NewClient(addr, password string, db int) *Client {
+	return &Client{Addr: addr, Password: password, DB: db, Timeout: 5 * time.Second}
+}
+
+// Do sends the command and returns the reply, which is one of
+// int64, string, []interface{} or an error.
+func (c *Client) Do(args ...string) (interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		if err := c.dial(); err != nil {
+			return nil, err
+		}
+	}
+	reply, err := c.do(args...)
+	if err != nil {
+		if _, ok := err.(Error); !ok && err != ErrNil {
+			// connection is in an unknown state, start afresh next time
+			c.conn.Close()
+			c.conn = nil
+		}
+	}
+	return reply, err
+}
+
+// Close closes the underlying connection.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
+
+func (c *Client) dial() error {
+	conn, err := net.DialTimeout("tcp", c.Addr, c.Timeout)
+	if err != nil {
+		return err
+	}
+	c.conn = conn
+	c.rd = bufio.NewReader(conn)
+	if c.Password != "" {
+		if _, err = c.do("AUTH", c.Password); err != nil {
+			c.conn.Close()
+			c.conn = nil
+			return err
+		}
+	}
+	if c.DB != 0 {
+		if _, err = c.do("SELECT", strconv.Itoa(c.DB)); err != nil {
+			c.conn.Close()
+			c.conn = nil
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Client) do(args ...string) (interface{}, error) {
+	if c.Timeout > 0 {
+		c.conn.SetDeadline(time.Now().Add(c.Timeout))
+	}
+	buf := []byte(fmt.Sprintf("*%d\r\n", len(args)))
+	for _, a := range args {
+		buf = append(buf, fmt.Sprintf("$%d\r\n%s\r\n", len(a), a)...)
+	}
+	if _, err := c.conn.Write(buf); err != nil {
+		return nil, err
+	}
+	return c.read()
+}
+
+func (c *Client) read() (interface{}, error) {
+	line, err := c.rd.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 {
+		return nil, fmt.Errorf("resp: short reply %q", line)
+	}
+	line = line[:len(line)-2]
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, Error(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, ErrNil
+		}
+		b := make([]byte, n+2)
+		if _, err = io.ReadFull(c.rd, b); err != nil {
+			return nil, err
+		}
+		return string(b[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, ErrNil
+		}
+		arr := make([]interface{}, n)
+		for i := range arr {
+			v, err := c.read()
+			if e, ok := err.(Error); ok {
+				v = e
+			} else if err != nil && err != ErrNil {
+				return nil, err
+			}
+			arr[i] = v
+		}
+		return arr, nil
+	}
+	return nil, fmt.Errorf("resp: unknown reply %q", line)
+}
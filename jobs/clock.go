@@ -0,0 +1,37 @@
+package jobs
+
+import "time"
+
+// Clock is the source of the current time for the scheduler, all the
+// scheduling computations, i.e. delays, exec times and timestamps in the
+// stores, are made with the registered clock. Replacing it allows
+// simulating, replaying and fast forwarding schedules, check the
+// schedulertest package for a fake clock.
+type Clock interface {
+	Now() time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+var clock Clock = realClock{}
+
+// RegisterClock sets the clock used by the scheduler, nil
+// restores the real clock
+func RegisterClock(c Clock) {
+	if c == nil {
+		c = realClock{}
+	}
+	clock = c
+}
+
+// RegisteredClock returns the clock used by the scheduler
+func RegisteredClock() Clock {
+	return clock
+}
+
+// Now returns the current time, in UTC, from the registered clock
+func Now() time.Time {
+	return clock.Now().UTC()
+}
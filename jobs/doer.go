@@ -1,15 +1,60 @@
 package jobs
 
+import (
+	"errors"
+	"log"
+)
+
 type Doer interface {
 	Enqueue(j *Job) error
 	Monitor(c Config)
 }
 
+// Returned by Enqueue when no Doer is registered
+var ErrNoDoer = errors.New("no queue implementation registered")
+
 var doer Doer
 
+// RegisterDoer sets the queue implementation, usually with backend.Use,
+// or the Init function of the implementation
 func RegisterDoer(d Doer) {
 	doer = d
 }
 
-func Enqueue(j *Job) error { return doer.Enqueue(j) }
-func Monitor(c Config)     { doer.Monitor(c); return }
+// RegisteredDoer returns the registered queue implementation, nil if none
+func RegisteredDoer() Doer {
+	return doer
+}
+
+// Monitor returns right away if no Doer is registered
+func Monitor(c Config) {
+	if doer == nil {
+		log.Print("no queue implementation registered, not monitoring ", c.QueueName)
+		return
+	}
+	doer.Monitor(c)
+}
+
+// Enqueue validates and submits the job to the registered Doer,
+// returns a *ValidationError if the job is invalid.
+func Enqueue(j *Job) error {
+	if doer == nil {
+		return ErrNoDoer
+	}
+	err := Validate(j)
+	if err != nil {
+		return err
+	}
+	err = scheduleSingleton(j)
+	if err != nil {
+		return err
+	}
+	err = doer.Enqueue(j)
+	if err != nil {
+		unscheduleSingleton(j)
+		return err
+	}
+	setStatus(j, StatusScheduled, nil)
+	emit(EventEnqueued, j, nil)
+	return nil
+}
@@ -0,0 +1,243 @@
+package jobs
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// The errors below are returned by executors to tell the queue
+// implementations what to do with a job which did not succeed.
+// An error which is not wrapped by any of them is treated like
+// SkipOccurrence.
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent wraps an error, after which retrying the job is pointless,
+// for eg: the user it is for does not exist anymore. The job is
+// dead-lettered, and a recurring job does not recur anymore.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+type retryError struct {
+	err   error
+	after time.Duration
+}
+
+func (e *retryError) Error() string { return e.err.Error() }
+func (e *retryError) Unwrap() error { return e.err }
+
+// MaxAttempts is the number of retries after which a job is dead-lettered,
+// instead of being retried again, unless the job has a MaxAttempts of its
+// own. 0 retries the jobs indefinitely.
+var MaxAttempts = 25
+
+// RetryAfter wraps a transient error, for eg: a timeout, the job is
+// enqueued again to be executed after d. Job.Attempts is incremented
+// on every retry, and can be used by the executor to give up. The job
+// is dead-lettered once it has been retried MaxAttempts times.
+func RetryAfter(err error, d time.Duration) error {
+	if err == nil {
+		return nil
+	}
+	return &retryError{err: err, after: d}
+}
+
+type skipError struct {
+	err error
+}
+
+func (e *skipError) Error() string { return e.err.Error() }
+func (e *skipError) Unwrap() error { return e.err }
+
+// SkipOccurrence wraps an error for which the job is not retried,
+// a recurring job is executed again at its next occurrence.
+func SkipOccurrence(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &skipError{err: err}
+}
+
+type stopError struct {
+	err error
+}
+
+func (e *stopError) Error() string {
+	if e.err == nil {
+		return "recurrence stopped"
+	}
+	return e.err.Error()
+}
+
+func (e *stopError) Unwrap() error { return e.err }
+
+// StopRecurrence ends the series of a recurring job, err may be nil if
+// the job succeeded, and is the last one of the series.
+func StopRecurrence(err error) error {
+	return &stopError{err: err}
+}
+
+// Action is what the queue implementation must do with a job processed
+type Action int
+
+const (
+	// Nothing more to do with the job
+	ActionDone Action = iota
+
+	// Enqueue the job again, for its next occurrence
+	ActionReschedule
+
+	// Enqueue the job again, to be retried
+	ActionRetry
+
+	// Send the job to the dead letter queue
+	ActionDeadLetter
+
+	// Drop the job, it is cancelled, or a duplicate of a singleton
+	ActionDrop
+
+	// Enqueue the job again, as its type is paused
+	ActionHold
+)
+
+func (a Action) String() string {
+	switch a {
+	case ActionDone:
+		return "done"
+	case ActionReschedule:
+		return "reschedule"
+	case ActionRetry:
+		return "retry"
+	case ActionDeadLetter:
+		return "dead-letter"
+	case ActionDrop:
+		return "drop"
+	case ActionHold:
+		return "hold"
+	}
+	return "unknown"
+}
+
+// giveUp makes the retryable error of a job which has been
+// retried MaxAttempts times a permanent one
+func giveUp(j *Job, err error) error {
+	var rerr *retryError
+	if !errors.As(err, &rerr) {
+		return err
+	}
+	max := MaxAttempts
+	if j.MaxAttempts > 0 {
+		max = j.MaxAttempts
+	}
+	if max <= 0 || j.Attempts < max {
+		return err
+	}
+	return Permanent(fmt.Errorf("giving up after %d attempts: %w", j.Attempts, err))
+}
+
+// ShouldDeadLetter reports whether a job, for which Execute returned err,
+// must be dead-lettered instead of being retried or re-enqueued.
+func ShouldDeadLetter(err error) bool {
+	var rerr *ResolveError
+	var perr *permanentError
+	return errors.As(err, &rerr) || errors.As(err, &perr)
+}
+
+// Process executes the job, and returns what the queue implementation must
+// do next, along with the error returned by Execute. For ActionReschedule,
+// ActionRetry and ActionHold, ExecTime of the job is set to the time it is
+// due next, and the job must be passed to Enqueue. Jobs of a paused type
+// are not executed, ActionHold is returned for them unless they have been
+// cancelled or rescheduled meanwhile. Once the action is carried out, the
+// queue implementation must call Settled.
+func Process(j *Job) (Action, error) {
+	// stale jobs go through Execute, which drops them without running them
+	if TypePaused(j.Type) && !IsStale(j) {
+		log.Printf("job type paused, holding JobID: %s, JobType: %s", j.ID, j.Type)
+		j.ExecTime = Now().Add(PausedTypeDelay)
+		return ActionHold, nil
+	}
+	err := Execute(j)
+	action := nextAction(j, err)
+	switch action {
+	case ActionRetry:
+		var rerr *retryError
+		errors.As(err, &rerr)
+		j.Attempts++
+		j.ExecTime = Now().Add(rerr.after)
+	case ActionReschedule:
+		j.Attempts = 0
+		j.ExecTime = Now().Add(time.Duration(j.Interval) * time.Millisecond)
+	case ActionDeadLetter:
+		unscheduleSingleton(j)
+	default: // not enqueued again
+		if err != ErrSuperseded { // the rescheduled copy holds the lock
+			unscheduleSingleton(j)
+		}
+	}
+	return action, err
+}
+
+// Settled emits EventRetried, EventRescheduled or EventDeadLettered for the
+// action returned by Process, along with err, once the queue implementation
+// has enqueued the job again, or dead-lettered it. It must not be called if
+// that failed, or if the job was settled otherwise, for eg: requeued.
+// ActionDeadLetter may be passed for a job dead-lettered instead of the
+// action returned by Process, for eg: as it could not be enqueued again,
+// the job is marked dead, and its singleton schedule lock released.
+func Settled(j *Job, action Action, err error) {
+	switch action {
+	case ActionRetry:
+		emit(EventRetried, j, err)
+	case ActionReschedule:
+		emit(EventRescheduled, j, nil)
+	case ActionDeadLetter:
+		unscheduleSingleton(j)
+		setStatus(j, StatusDead, err)
+		emit(EventDeadLettered, j, err)
+	}
+}
+
+func nextAction(j *Job, err error) Action {
+	var rerr *retryError
+	var serr *stopError
+	switch {
+	case err == ErrLocked || err == ErrCancelled || err == ErrSuperseded:
+		return ActionDrop
+	case ShouldDeadLetter(err):
+		return ActionDeadLetter
+	case errors.As(err, &rerr):
+		return ActionRetry
+	case errors.As(err, &serr):
+		j.IsRecurring = false
+		return ActionDone
+	case j.IsRecurring:
+		return ActionReschedule
+	}
+	return ActionDone
+}
+
+// finalStatus is the status of the job in the store, after Execute
+func finalStatus(err error) Status {
+	var serr *stopError
+	switch {
+	case err == nil:
+		return StatusSucceeded
+	case errors.As(err, &serr) && serr.err == nil:
+		return StatusSucceeded
+	case ShouldDeadLetter(err):
+		return StatusDead
+	}
+	return StatusFailed
+}
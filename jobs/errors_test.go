@@ -0,0 +1,121 @@
+package jobs
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// funcExecutor returns err from every execution
+type funcExecutor struct {
+	err error
+}
+
+func (e *funcExecutor) New() Executor        { return e }
+func (e *funcExecutor) Execute(j *Job) error { return e.err }
+func registerFunc(jobType string, err error) *Job {
+	RegisterExecutor(jobType, &funcExecutor{err: err})
+	return &Job{ID: "1", Type: jobType, Interval: 1000}
+}
+
+func TestProcessActions(t *testing.T) {
+	failed := errors.New("failed")
+	cases := []struct {
+		name      string
+		err       error
+		recurring bool
+		action    Action
+	}{
+		{"success", nil, false, ActionDone},
+		{"success recurring", nil, true, ActionReschedule},
+		{"plain error", failed, false, ActionDone},
+		{"plain error recurring", failed, true, ActionReschedule},
+		{"skip recurring", SkipOccurrence(failed), true, ActionReschedule},
+		{"permanent", Permanent(failed), true, ActionDeadLetter},
+		{"retry", RetryAfter(failed, time.Minute), false, ActionRetry},
+		{"stop", StopRecurrence(nil), true, ActionDone},
+	}
+	for _, c := range cases {
+		j := registerFunc("Test"+c.name, c.err)
+		j.IsRecurring = c.recurring
+		action, err := Process(j)
+		if action != c.action {
+			t.Errorf("%s: got %s, want %s", c.name, action, c.action)
+		}
+		if !errors.Is(err, c.err) {
+			t.Errorf("%s: got error %v, want %v", c.name, err, c.err)
+		}
+	}
+}
+
+func TestProcessRetry(t *testing.T) {
+	j := registerFunc("TestRetry", RetryAfter(errors.New("timeout"), time.Minute))
+	before := Now()
+	action, _ := Process(j)
+	if action != ActionRetry || j.Attempts != 1 {
+		t.Fatalf("got %s with %d attempts, want retry with 1", action, j.Attempts)
+	}
+	if j.ExecTime.Before(before.Add(time.Minute)) {
+		t.Errorf("exec time %v not a minute after %v", j.ExecTime, before)
+	}
+}
+
+func TestMaxAttempts(t *testing.T) {
+	defer func(max int) { MaxAttempts = max }(MaxAttempts)
+	MaxAttempts = 3
+	j := registerFunc("TestMaxAttempts", RetryAfter(errors.New("timeout"), time.Second))
+	for i := 0; i < 3; i++ {
+		action, _ := Process(j)
+		if action != ActionRetry {
+			t.Fatalf("attempt %d: got %s, want retry", i, action)
+		}
+	}
+	action, err := Process(j)
+	if action != ActionDeadLetter || !ShouldDeadLetter(err) {
+		t.Errorf("got %s, %v, want dead-letter after 3 attempts", action, err)
+	}
+
+	// the job's own limit wins
+	j = registerFunc("TestMaxAttempts", RetryAfter(errors.New("timeout"), time.Second))
+	j.MaxAttempts = 1
+	Process(j)
+	if action, _ := Process(j); action != ActionDeadLetter {
+		t.Errorf("got %s, want dead-letter after the job's 1 attempt", action)
+	}
+
+	// unlimited
+	MaxAttempts = 0
+	j = registerFunc("TestMaxAttempts", RetryAfter(errors.New("timeout"), time.Second))
+	j.Attempts = 1000
+	if action, _ := Process(j); action != ActionRetry {
+		t.Errorf("got %s, want retry without a limit", action)
+	}
+}
+
+func TestSettledEvents(t *testing.T) {
+	var events []Event
+	RegisterHook(func(e Event, j *Job, err error) {
+		if j.Type == "TestSettled" {
+			events = append(events, e)
+		}
+	}, EventRetried, EventRescheduled, EventDeadLettered)
+
+	j := registerFunc("TestSettled", RetryAfter(errors.New("timeout"), time.Second))
+	action, err := Process(j)
+	if len(events) != 0 {
+		t.Fatalf("got %v before the job was settled", events)
+	}
+	Settled(j, action, err)
+	Settled(j, ActionReschedule, nil)
+	Settled(j, ActionDeadLetter, err)
+	Settled(j, ActionHold, nil)
+	want := []Event{EventRetried, EventRescheduled, EventDeadLettered}
+	if len(events) != len(want) {
+		t.Fatalf("got %v, want %v", events, want)
+	}
+	for i := range want {
+		if events[i] != want[i] {
+			t.Errorf("got %v, want %v", events, want)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package jobs
+
+import (
+	"log"
+	"sync"
+)
+
+// Event in the lifecycle of a job
+type Event string
+
+const (
+	// The job was submitted to the queue, this includes the re-enqueues
+	// for retries and for the next occurrences of recurring jobs
+	EventEnqueued Event = "enqueued"
+
+	// The executor of the job is about to be run
+	EventStarted Event = "started"
+
+	EventSucceeded Event = "succeeded"
+	EventFailed    Event = "failed"
+
+	// The job failed, and has been enqueued again to be retried
+	EventRetried Event = "retried"
+
+	// The job cannot be executed, and has been dead-lettered
+	EventDeadLettered Event = "dead_lettered"
+
+	// The recurring job has been enqueued again for its next occurrence
+	EventRescheduled Event = "rescheduled"
+)
+
+// Hook is called for the events of the jobs, err is the error returned
+// by the executor, for EventFailed, EventRetried and EventDeadLettered.
+// Hooks are called synchronously, by the goroutine processing the job,
+// hence must not block for long. EventRetried, EventRescheduled and
+// EventDeadLettered are emitted by the queue implementations, with
+// Settled, only once the job has been enqueued again, or dead-lettered.
+type Hook func(e Event, j *Job, err error)
+
+type hookEntry struct {
+	hook   Hook
+	events map[Event]bool
+}
+
+var hooksMu sync.RWMutex
+var hooks []hookEntry
+
+// RegisterHook registers h to be called for the events,
+// or for all the events if none is given
+func RegisterHook(h Hook, events ...Event) {
+	e := hookEntry{hook: h}
+	if len(events) > 0 {
+		e.events = map[Event]bool{}
+		for _, v := range events {
+			e.events[v] = true
+		}
+	}
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	hooks = append(hooks, e)
+}
+
+func emit(e Event, j *Job, err error) {
+	hooksMu.RLock()
+	list := hooks
+	hooksMu.RUnlock()
+	for _, v := range list {
+		if v.events != nil && !v.events[e] {
+			continue
+		}
+		callHook(v.hook, e, j, err)
+	}
+}
+
+// a panic in a hook must not stop the job from being processed
+func callHook(h Hook, e Event, j *Job, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("recovered from panic in hook for %s, JobID: %s: %v", e, j.ID, r)
+		}
+	}()
+	h(e, j, err)
+}
@@ -2,8 +2,10 @@ package jobs
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
-	"reflect"
+	"sort"
 	"time"
 )
 
@@ -16,6 +18,13 @@ type Config struct {
 	// schedler not for rmq, but is mandatory
 	// for sqs based scheduler
 	RegionName string
+
+	// Jobs which cannot be executed, i.e. for which ShouldDeadLetter
+	// is true, are sent to this queue. Used only by sqs, it must be in
+	// the same region. If empty, the one set in sqs.Setup is used, and
+	// the jobs are dropped if there is none.
+	// For rmq, the dead letter queue is set in Setup with RMQConfig.
+	DeadLetterQueue string
 }
 
 // This interface must be implemented by the user,
@@ -27,7 +36,9 @@ type Executor interface {
 
 	// Execute will have all the logic associated with the job,
 	// Job struct is passed as argument, so that any changes in the
-	// Job related data like IsRecurring can be changed by the user
+	// Job related data like IsRecurring can be changed by the user.
+	// Long running jobs can report their progress with j.Progress(),
+	// and should stop once j.Context() is done
 	Execute(j *Job) error
 }
 
@@ -42,6 +53,17 @@ func init() {
 // that type are submitted
 func RegisterExecutor(jobType string, executor Executor) {
 	executors[jobType] = executor
+	knownTypes[jobType] = true
+}
+
+// ExecutorTypes returns the job types, with a registered executor, sorted
+func ExecutorTypes() []string {
+	types := make([]string, 0, len(executors))
+	for k := range executors {
+		types = append(types, k)
+	}
+	sort.Strings(types)
+	return types
 }
 
 // Job defines the attributes required to run the job,
@@ -80,32 +102,145 @@ type Job struct {
 	// this interval value is taken from the Interval attribute
 	IsRecurring bool `json:"is_recurring"`
 
-	// This is the time at which a job is to be executed,
-	// this is used in sqs implementation and must be provided,
-	// while submitting the job, it should be equal to EnqueueTime + Interval
+	// This is the time at which a job is to be executed, the job is delayed
+	// in the queue till then, check Delay(). It must be provided for sqs,
+	// while submitting the job, it should be equal to EnqueueTime + Interval.
+	// For rmq, if not provided, the job is delayed by Interval
 	ExecTime time.Time `json:"exec_time"`
 
 	// It is an interface, which could hold job specific data,
 	// For eg: if a push notification is to be sent for a user, it could contain
 	// UserId, and related data
 	JobData interface{} `json:"job_data"`
+
+	// Number of times the job has been retried, after its executor returned
+	// an error wrapped with RetryAfter. Reset to 0 for the next occurrence
+	// of a recurring job
+	Attempts int `json:"attempts,omitempty"`
+
+	// Number of retries after which the job is dead-lettered,
+	// the package MaxAttempts is used if 0
+	MaxAttempts int `json:"max_attempts,omitempty"`
+
+	// Used only for job types registered with RegisterSingleton,
+	// only one job is scheduled, and run at a time, per key.
+	// If empty, all jobs of the type share one lock
+	SingletonKey string `json:"singleton_key,omitempty"`
+
+	// Arbitrary labels, like tenant or campaign, for finding the jobs,
+	// and operating on them in bulk, check FindByTags
+	Tags map[string]string `json:"tags,omitempty"`
+
+	// set while the job runs, check Progress() and Heartbeat()
+	run *runState
 }
 
-func (j *Job) GetExecutor() Executor {
-	// panic point, if exector not registered
-	// log.Println("Executors registered: ", executors)
-	// log.Println("Job Type: ", j.Type)
+// Execute runs the job with the executor registered for its type,
+// queue implementations should use Process instead, which calls Execute.
+// Returns ErrCancelled if the job has been cancelled, ErrSuperseded if it has been
+// rescheduled, and ErrLocked, if the job is a singleton and another instance
+// of it is running or scheduled.
+// A *ResolveError is returned if an executor cannot be resolved for the job.
+// A panic in the executor is returned as an error.
+func Execute(j *Job) error {
+	if isCancelled(j) {
+		return ErrCancelled
+	}
+	if isSuperseded(j) {
+		return ErrSuperseded
+	}
+	executor, err := j.GetExecutor()
+	if err != nil {
+		setStatus(j, StatusDead, err)
+		return err
+	}
+	unlock, err := lockSingleton(j)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	setStatus(j, StatusRunning, nil)
+	emit(EventStarted, j, nil)
+	stop := startRun(j)
+	err = giveUp(j, run(executor, j))
+	stop()
+	status := finalStatus(err)
+	setStatus(j, status, err)
+	if status == StatusSucceeded {
+		emit(EventSucceeded, j, nil)
+	} else {
+		emit(EventFailed, j, err)
+	}
+	return err
+}
+
+// Delay is the time after which the job is due, it is the time left till
+// ExecTime, or Interval if ExecTime is not set. It is never negative.
+func (j *Job) Delay() time.Duration {
+	d := time.Duration(j.Interval) * time.Millisecond
+	if !j.ExecTime.IsZero() {
+		d = j.ExecTime.Sub(Now())
+	}
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+// run returns a panic in the executor as an error,
+// and saves the result of a ResultExecutor
+func run(e Executor, j *Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("recovered from panic in executor, JobID: %s, JobType: %s: %v", j.ID, j.Type, r)
+			err = fmt.Errorf("executor panicked: %v", r)
+		}
+	}()
+	if re, ok := e.(ResultExecutor); ok {
+		var result interface{}
+		result, err = re.ExecuteResult(j)
+		saveResult(j, result, err)
+		return err
+	}
+	return e.Execute(j)
+}
+
+// ResolveError is returned by GetExecutor, and Execute, when an executor
+// cannot be resolved for the job, i.e. the job type is not registered, or
+// the JobData does not fit the executor. Retrying such jobs is pointless,
+// hence they are dead-lettered by the queue implementations.
+type ResolveError struct {
+	Type string
+	Err  error
+}
+
+func (e *ResolveError) Error() string {
+	return fmt.Sprintf("cannot resolve executor for job type %q: %v", e.Type, e.Err)
+}
+
+func (e *ResolveError) Unwrap() error {
+	return e.Err
+}
+
+// GetExecutor returns a new executor for the job type,
+// with the JobData unmarshalled into it
+func (j *Job) GetExecutor() (Executor, error) {
+	e, ok := executors[j.Type]
+	if !ok || e == nil {
+		return nil, &ResolveError{Type: j.Type, Err: ErrUnknownExecutor}
+	}
 	data, err := json.Marshal(j.JobData)
 	if err != nil {
-		return nil
+		return nil, &ResolveError{Type: j.Type, Err: err}
 	}
-	e := executors[j.Type]
 	executor := e.New()
-	log.Println("type of interface: ", reflect.TypeOf(executor))
+	if executor == nil {
+		return nil, &ResolveError{Type: j.Type, Err: errors.New("New() returned nil")}
+	}
 	err = json.Unmarshal(data, executor)
 	if err != nil {
-		log.Println(err)
-		return nil
+		return nil, &ResolveError{Type: j.Type, Err: err}
 	}
-	return executor
+	return executor, nil
 }
@@ -0,0 +1,181 @@
+package jobs
+
+import (
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Jobs of a paused type are enqueued again, to be received after this delay
+var PausedTypeDelay = time.Minute
+
+// PauseStore keeps the paused queues and job types, so that pausing is
+// effective across all the processes sharing it. Check the store package
+// for the implementations.
+type PauseStore interface {
+	// SetPaused pauses, or resumes, the queue or job type identified by key
+	SetPaused(key string, paused bool) error
+
+	// Paused returns the keys of all the paused queues and job types
+	Paused() ([]string, error)
+}
+
+var pauseStore PauseStore
+
+// the paused keys, as last read from pauseStore
+var pausedMu sync.Mutex
+var paused map[string]bool
+var pausedReadAt time.Time
+
+// pausedGen is incremented on every change made in this process, so that
+// keys read from the store concurrently with it are discarded
+var pausedGen int
+var pausedReading bool
+
+// the paused keys are read from the store at most this often
+const pauseRefresh = time.Second
+
+func init() {
+	paused = map[string]bool{}
+}
+
+// RegisterPauseStore sets the store for the paused queues and job types,
+// without it pausing is effective only in the process calling PauseQueue
+// or PauseType.
+func RegisterPauseStore(s PauseStore) {
+	pausedMu.Lock()
+	defer pausedMu.Unlock()
+	pauseStore = s
+	pausedReadAt = time.Time{}
+	pausedGen++
+}
+
+func queueKey(queue string) string   { return "queue:" + queue }
+func typeKey(jobType string) string { return "type:" + jobType }
+
+// PauseQueue stops the Monitor of the queue from fetching new jobs
+// until ResumeQueue is called. Jobs already fetched are run to completion.
+func PauseQueue(queue string) error {
+	return setPaused(queueKey(queue), true)
+}
+
+func ResumeQueue(queue string) error {
+	return setPaused(queueKey(queue), false)
+}
+
+func QueuePaused(queue string) bool {
+	return isPaused(queueKey(queue))
+}
+
+// PauseType holds back the jobs of the type until ResumeType is called,
+// the jobs received meanwhile are enqueued again after PausedTypeDelay.
+// Jobs already running are run to completion.
+func PauseType(jobType string) error {
+	return setPaused(typeKey(jobType), true)
+}
+
+func ResumeType(jobType string) error {
+	return setPaused(typeKey(jobType), false)
+}
+
+func TypePaused(jobType string) bool {
+	return isPaused(typeKey(jobType))
+}
+
+// PausedQueues returns the names of the paused queues, sorted
+func PausedQueues() []string {
+	return pausedWithPrefix("queue:")
+}
+
+// PausedTypes returns the paused job types, sorted
+func PausedTypes() []string {
+	return pausedWithPrefix("type:")
+}
+
+// WaitWhilePaused blocks while the queue is paused,
+// it is used by the queue implementations in Monitor
+func WaitWhilePaused(queue string) {
+	for QueuePaused(queue) {
+		time.Sleep(time.Second)
+	}
+}
+
+func setPaused(key string, p bool) error {
+	pausedMu.Lock()
+	s := pauseStore
+	pausedMu.Unlock()
+	if s != nil {
+		err := s.SetPaused(key, p)
+		if err != nil {
+			return err
+		}
+	}
+	pausedMu.Lock()
+	defer pausedMu.Unlock()
+	if p {
+		paused[key] = true
+	} else {
+		delete(paused, key)
+	}
+	pausedGen++
+	return nil
+}
+
+func isPaused(key string) bool {
+	refreshPaused()
+	pausedMu.Lock()
+	defer pausedMu.Unlock()
+	return paused[key]
+}
+
+func pausedWithPrefix(prefix string) []string {
+	refreshPaused()
+	pausedMu.Lock()
+	defer pausedMu.Unlock()
+	list := []string{}
+	for k := range paused {
+		if strings.HasPrefix(k, prefix) {
+			list = append(list, strings.TrimPrefix(k, prefix))
+		}
+	}
+	sort.Strings(list)
+	return list
+}
+
+// refreshPaused reads the paused keys from the store, if they were read
+// more than pauseRefresh ago, the last read keys are kept on errors.
+// The store is read without holding pausedMu, by one caller at a time,
+// the others go on with the last read keys meanwhile.
+func refreshPaused() {
+	pausedMu.Lock()
+	s, gen := pauseStore, pausedGen
+	if s == nil || pausedReading || time.Since(pausedReadAt) < pauseRefresh {
+		pausedMu.Unlock()
+		return
+	}
+	pausedReading = true
+	pausedReadAt = time.Now()
+	pausedMu.Unlock()
+
+	keys, err := s.Paused()
+
+	pausedMu.Lock()
+	defer pausedMu.Unlock()
+	pausedReading = false
+	if err != nil {
+		log.Print("error reading paused queues and job types: ", err)
+		return
+	}
+	// keys read before a pause, resume or store change are stale
+	if gen != pausedGen {
+		pausedReadAt = time.Time{}
+		return
+	}
+	m := map[string]bool{}
+	for _, k := range keys {
+		m[k] = true
+	}
+	paused = m
+}
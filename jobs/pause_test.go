@@ -0,0 +1,124 @@
+package jobs
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// slowPauseStore blocks in Paused until release is closed, returning
+// the keys as they were when the read started
+type slowPauseStore struct {
+	mu      sync.Mutex
+	keys    map[string]bool
+	reading chan bool
+	release chan bool
+}
+
+func (s *slowPauseStore) SetPaused(key string, p bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[key] = p
+	return nil
+}
+
+func (s *slowPauseStore) Paused() ([]string, error) {
+	s.mu.Lock()
+	keys := []string{}
+	for k, p := range s.keys {
+		if p {
+			keys = append(keys, k)
+		}
+	}
+	s.mu.Unlock()
+	select {
+	case s.reading <- true:
+	default:
+	}
+	<-s.release
+	return keys, nil
+}
+
+func TestPausedReadOutsideLock(t *testing.T) {
+	s := &slowPauseStore{
+		keys:    map[string]bool{typeKey("TestSlow"): true},
+		reading: make(chan bool, 1),
+		release: make(chan bool),
+	}
+	RegisterPauseStore(s)
+	defer RegisterPauseStore(nil)
+
+	done := make(chan bool)
+	go func() {
+		TypePaused("TestSlow")
+		done <- true
+	}()
+	<-s.reading
+
+	// a read in progress does not block the other callers
+	checked := make(chan bool)
+	go func() {
+		QueuePaused("other")
+		PauseType("TestLocal")
+		checked <- true
+	}()
+	select {
+	case <-checked:
+	case <-time.After(time.Second):
+		t.Fatal("blocked while the paused keys were being read")
+	}
+
+	close(s.release)
+	<-done
+	if !TypePaused("TestSlow") {
+		t.Error("paused type not read from the store")
+	}
+	// the keys read concurrently with PauseType are discarded
+	if !TypePaused("TestLocal") {
+		t.Error("pause made while reading the store was lost")
+	}
+	ResumeType("TestLocal")
+}
+
+// mapStore keeps the records in memory
+type mapStore map[string]*Record
+
+func (s mapStore) Save(r *Record) error { s[r.Job.ID] = r; return nil }
+func (s mapStore) Delete(id string) error {
+	delete(s, id)
+	return nil
+}
+func (s mapStore) List() ([]*Record, error) {
+	list := []*Record{}
+	for _, r := range s {
+		list = append(list, r)
+	}
+	return list, nil
+}
+func (s mapStore) Get(id string) (*Record, error) {
+	r, ok := s[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return r, nil
+}
+
+func TestPausedTypeCancelled(t *testing.T) {
+	s := mapStore{}
+	RegisterStore(s)
+	defer RegisterStore(nil)
+	PauseType("TestPausedCancelled")
+	defer ResumeType("TestPausedCancelled")
+
+	j := registerFunc("TestPausedCancelled", nil)
+	s.Save(&Record{Job: j, Status: StatusScheduled})
+	if action, _ := Process(j); action != ActionHold {
+		t.Errorf("got %s, want hold", action)
+	}
+
+	s.Save(&Record{Job: j, Status: StatusCancelled})
+	action, err := Process(j)
+	if action != ActionDrop || err != ErrCancelled {
+		t.Errorf("got %s, %v, want the cancelled job dropped", action, err)
+	}
+}
@@ -0,0 +1,130 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// HeartbeatInterval is how often a running job sends a heartbeat on its
+// own, it must be well below the visibility timeout of the sqs queues,
+// sqs refuses to monitor the queues otherwise.
+var HeartbeatInterval = 10 * time.Second
+
+// Returned by Progress and Heartbeat when called on a job not running
+var ErrNotRunning = errors.New("job not running")
+
+// state of a running job, shared by the executor and the heartbeat loop
+type runState struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu        sync.Mutex // serializes the updates of the record
+	heartbeat func() error
+}
+
+// SetHeartbeatFunc sets the func called on every heartbeat of the job while
+// it runs, it must be called before Process. It is used by the queue
+// implementations, for eg: sqs extends the visibility of the message.
+func (j *Job) SetHeartbeatFunc(f func() error) {
+	if j.run == nil {
+		j.run = &runState{}
+	}
+	j.run.heartbeat = f
+}
+
+// Context returns the context of the running job, it is cancelled when the
+// job is cancelled with Cancel, or once the job returns. It is
+// context.Background() if the job is not running.
+func (j *Job) Context() context.Context {
+	if j.run == nil || j.run.ctx == nil {
+		return context.Background()
+	}
+	return j.run.ctx
+}
+
+// Heartbeat tells that the job is still alive, heartbeats are sent every
+// HeartbeatInterval on their own, so an executor needs to call it only to
+// know early about a failing queue, or a cancellation.
+func (j *Job) Heartbeat() error {
+	if !j.running() {
+		return ErrNotRunning
+	}
+	j.run.mu.Lock()
+	defer j.run.mu.Unlock()
+	return j.beat()
+}
+
+// Progress reports the progress of the job, percent is from 0 to 100, it is
+// saved in the job store along with the message. Progress is a heartbeat too.
+func (j *Job) Progress(percent int, message string) error {
+	if !j.running() {
+		return ErrNotRunning
+	}
+	if percent < 0 {
+		percent = 0
+	}
+	if percent > 100 {
+		percent = 100
+	}
+	j.run.mu.Lock()
+	defer j.run.mu.Unlock()
+	updateRecord(j, func(r *Record) {
+		r.Progress = percent
+		r.ProgressMessage = message
+	})
+	return j.beat()
+}
+
+func (j *Job) running() bool {
+	return j.run != nil && j.run.ctx != nil && j.run.ctx.Err() == nil
+}
+
+// beat must be called with j.run.mu held
+func (j *Job) beat() error {
+	if isCancelled(j) {
+		j.run.cancel()
+		return ErrCancelled
+	}
+	updateRecord(j, func(r *Record) {
+		r.HeartbeatAt = Now()
+	})
+	if j.run.heartbeat != nil {
+		return j.run.heartbeat()
+	}
+	return nil
+}
+
+// startRun sets up the context of the job, and sends heartbeats till the
+// returned func is called, which waits for the last heartbeat to finish
+func startRun(j *Job) func() {
+	if j.run == nil {
+		j.run = &runState{}
+	}
+	j.run.ctx, j.run.cancel = context.WithCancel(context.Background())
+	done := make(chan bool)
+	stopped := make(chan bool)
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(HeartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				err := j.Heartbeat()
+				if err != nil {
+					log.Printf("heartbeat failed, JobID: %s, JobType: %s: %v", j.ID, j.Type, err)
+				}
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+		j.run.cancel()
+	}
+}
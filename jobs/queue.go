@@ -0,0 +1,43 @@
+package jobs
+
+import "errors"
+
+// Returned when the registered Doer does not support an operation
+var ErrNotSupported = errors.New("operation not supported by the queue implementation")
+
+// QueueInfo describes a queue known to the queue implementation
+type QueueInfo struct {
+	Name string `json:"name"`
+
+	// Region of the queue, empty for rmq
+	Region string `json:"region,omitempty"`
+
+	// Approximate number of messages in the queue
+	Messages int64 `json:"messages"`
+
+	// True if consumption from the queue is paused
+	Paused bool `json:"paused"`
+}
+
+// QueueLister is implemented by the Doers which can list their queues,
+// i.e. the queues created with Setup, or being monitored.
+type QueueLister interface {
+	Queues() ([]QueueInfo, error)
+}
+
+// Queues lists the queues known to the registered Doer,
+// returns ErrNotSupported if the Doer is not a QueueLister
+func Queues() ([]QueueInfo, error) {
+	l, ok := doer.(QueueLister)
+	if !ok {
+		return nil, ErrNotSupported
+	}
+	queues, err := l.Queues()
+	if err != nil {
+		return nil, err
+	}
+	for i := range queues {
+		queues[i].Paused = QueuePaused(queues[i].Name)
+	}
+	return queues, nil
+}
@@ -0,0 +1,87 @@
+package jobs
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+)
+
+// ResultExecutor is implemented by the executors which produce a result,
+// for eg: the url of a generated file. ExecuteResult is called instead of
+// Execute, and the result is saved in the registered ResultStore.
+type ResultExecutor interface {
+	Executor
+
+	// The result must be encodable as json
+	ExecuteResult(j *Job) (interface{}, error)
+}
+
+// Result of a job execution, as kept in the ResultStore.
+// For a recurring job only the result of the latest execution is kept.
+type Result struct {
+	JobID string `json:"job_id"`
+	Type  string `json:"type"`
+
+	// The result, encoded as json
+	Data json.RawMessage `json:"data"`
+
+	// Error returned by ExecuteResult, if any
+	Error string `json:"error,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Decode unmarshals the result into v
+func (r *Result) Decode(v interface{}) error {
+	return json.Unmarshal(r.Data, v)
+}
+
+// ResultStore keeps the results of the jobs till they expire,
+// check the store package for the implementations.
+type ResultStore interface {
+	SaveResult(r *Result) error
+
+	// GetResult returns ErrNotFound if there is no result for the job,
+	// or if it has expired
+	GetResult(jobID string) (*Result, error)
+}
+
+var resultStore ResultStore
+var resultTTL time.Duration
+
+// RegisterResultStore sets the store for the results of the jobs,
+// results are kept for ttl after they are saved.
+func RegisterResultStore(s ResultStore, ttl time.Duration) {
+	resultStore = s
+	resultTTL = ttl
+}
+
+// GetResult returns the result of the latest execution of the job
+func GetResult(jobID string) (*Result, error) {
+	if resultStore == nil {
+		return nil, ErrNoStore
+	}
+	return resultStore.GetResult(jobID)
+}
+
+func saveResult(j *Job, data interface{}, cause error) {
+	if resultStore == nil {
+		log.Print("no result store registered, dropping result of job: ", j.ID)
+		return
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("error encoding result, JobID: %s: %v", j.ID, err)
+		return
+	}
+	now := Now()
+	r := &Result{JobID: j.ID, Type: j.Type, Data: b, CreatedAt: now, ExpiresAt: now.Add(resultTTL)}
+	if cause != nil {
+		r.Error = cause.Error()
+	}
+	err = resultStore.SaveResult(r)
+	if err != nil {
+		log.Printf("error saving result, JobID: %s: %v", j.ID, err)
+	}
+}
@@ -0,0 +1,152 @@
+package jobs
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"time"
+)
+
+// Schedule declares a recurring job, Reconcile makes sure that exactly one
+// job is scheduled for every declared Schedule.
+// The fields are the same as in the Job struct.
+type Schedule struct {
+	// Name identifies the schedule, it must be unique
+	Name string `json:"name"`
+
+	Type        string      `json:"type"`
+	Interval    int64       `json:"interval"`
+	RoutingKey  string      `json:"routing_key"`
+	Queue       string      `json:"queue"`
+	QueueRegion string      `json:"queue_region"`
+	JobData     interface{} `json:"job_data"`
+}
+
+var schedules map[string]Schedule
+
+func init() {
+	schedules = map[string]Schedule{}
+}
+
+// Declare adds the schedule to the registry,
+// a schedule declared again with the same name replaces the old one.
+func Declare(s Schedule) {
+	schedules[s.Name] = s
+}
+
+// LoadSchedules declares all the schedules in a json file,
+// the file must contain an array of schedules, for eg:
+//  [{"name": "nightly-cleanup", "type": "Cleanup", "interval": 86400000,
+//    "queue": "test-queue", "queue_region": "APSoutheast", "job_data": {"days": 7}}]
+func LoadSchedules(path string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var list []struct {
+		Schedule
+		JobData json.RawMessage `json:"job_data"`
+	}
+	err = json.Unmarshal(b, &list)
+	if err != nil {
+		return err
+	}
+	for _, v := range list {
+		if v.Name == "" {
+			return errors.New("schedule without a name in " + path)
+		}
+		s := v.Schedule
+		if len(v.JobData) > 0 {
+			s.JobData = v.JobData
+		}
+		Declare(s)
+	}
+	return nil
+}
+
+// jobID is derived from the name, and the contents of the schedule,
+// so that any change in a schedule gives a new job
+func (s Schedule) jobID() (string, error) {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return "", err
+	}
+	sum := sha1.Sum(b)
+	return fmt.Sprintf("%s-%s", s.Name, hex.EncodeToString(sum[:])[:12]), nil
+}
+
+// Reconcile must be called on startup, after the store is registered.
+// It enqueues a job for each declared schedule not yet scheduled,
+// replaces the jobs of the schedules which have changed, and cancels
+// the jobs of the schedules which are not declared anymore.
+func Reconcile() error {
+	if store == nil {
+		return ErrNoStore
+	}
+	records, err := store.List()
+	if err != nil {
+		return err
+	}
+
+	wanted := map[string]string{} // job id against schedule name
+	for name, s := range schedules {
+		id, err := s.jobID()
+		if err != nil {
+			return err
+		}
+		wanted[id] = name
+	}
+
+	scheduled := map[string]bool{}
+	for _, r := range records {
+		// only the jobs still circulating in the queues matter
+		if r.Schedule == "" || (r.Status != StatusScheduled && r.Status != StatusRunning) {
+			continue
+		}
+		if _, ok := wanted[r.Job.ID]; ok {
+			scheduled[r.Job.ID] = true
+			continue
+		}
+		// changed or removed
+		log.Print("cancelling job for schedule: ", r.Schedule, " ", r.Job.ID)
+		err = Cancel(r.Job.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	for id, name := range wanted {
+		if scheduled[id] {
+			continue
+		}
+		s := schedules[name]
+		now := Now()
+		j := &Job{
+			ID:          id,
+			EnqueueTime: now,
+			Type:        s.Type,
+			Interval:    s.Interval,
+			RoutingKey:  s.RoutingKey,
+			Queue:       s.Queue,
+			QueueRegion: s.QueueRegion,
+			IsRecurring: true,
+			ExecTime:    now.Add(time.Duration(s.Interval) * time.Millisecond),
+			JobData:     s.JobData,
+		}
+		log.Print("enqueueing job for schedule: ", name, " ", id)
+		err = store.Save(&Record{Job: j, Status: StatusScheduled, Schedule: name, UpdatedAt: now})
+		if err != nil {
+			return err
+		}
+		err = Enqueue(j)
+		if err != nil {
+			store.Delete(id)
+			return err
+		}
+	}
+	return nil
+}
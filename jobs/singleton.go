@@ -0,0 +1,127 @@
+package jobs
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/betacraft/scheduler/lock"
+)
+
+var (
+	// Returned by Enqueue when another instance of a singleton job,
+	// with the same key, is already scheduled
+	ErrAlreadyScheduled = errors.New("singleton job already scheduled")
+
+	// Returned by Execute when another instance of a singleton job,
+	// with the same key, is running or is the one scheduled
+	ErrLocked = errors.New("singleton job locked by another instance")
+)
+
+var locker lock.Locker
+
+// singleton job types against the maximum time a job
+// of the type is expected to run
+var singletons map[string]time.Duration
+
+func init() {
+	singletons = map[string]time.Duration{}
+}
+
+// RegisterLocker sets the lock implementation used for singleton jobs,
+// when publishers and consumers run as different processes it must be
+// a lock shared between them, like lock.RedisLocker.
+// An in-memory lock, on the registered clock, is used if none is registered.
+func RegisterLocker(l lock.Locker) {
+	locker = l
+}
+
+// RegisterSingleton marks a job type as singleton, only one job of the type
+// is scheduled, and is executed at a time, for each SingletonKey.
+// ttl is the maximum time a job of the type is expected to run, locks
+// are released after it if the consumer dies while running the job.
+func RegisterSingleton(jobType string, ttl time.Duration) {
+	if locker == nil {
+		l := lock.NewMemoryLocker()
+		l.Now = Now
+		locker = l
+	}
+	singletons[jobType] = ttl
+}
+
+func singletonKey(j *Job) string {
+	if j.SingletonKey != "" {
+		return j.Type + ":" + j.SingletonKey
+	}
+	return j.Type
+}
+
+// schedule lock is held by the job ID until the job
+// is expected to be executed, and re-enqueued
+func scheduleTTL(j *Job, ttl time.Duration) time.Duration {
+	delay := time.Duration(j.Interval) * time.Millisecond
+	if d := j.ExecTime.Sub(Now()); d > delay {
+		delay = d
+	}
+	return delay + ttl
+}
+
+// scheduleSingleton takes the schedule lock for the job, it succeeds
+// for the job already holding the lock, i.e. when a recurring job is
+// re-enqueued.
+func scheduleSingleton(j *Job) error {
+	ttl, ok := singletons[j.Type]
+	if !ok {
+		return nil
+	}
+	acquired, err := locker.Acquire("scheduled:"+singletonKey(j), j.ID, scheduleTTL(j, ttl))
+	if err != nil {
+		log.Print("error acquiring schedule lock: ", err)
+		return err
+	}
+	if !acquired {
+		return ErrAlreadyScheduled
+	}
+	return nil
+}
+
+func unscheduleSingleton(j *Job) {
+	if _, ok := singletons[j.Type]; !ok {
+		return
+	}
+	err := locker.Release("scheduled:"+singletonKey(j), j.ID)
+	if err != nil {
+		log.Print("error releasing schedule lock: ", err)
+	}
+}
+
+// lockSingleton takes the execution lock for the job, and returns the func
+// to release it. Copies of the job not holding the schedule lock, i.e. ones
+// enqueued before the job type was made singleton, are refused too.
+func lockSingleton(j *Job) (func(), error) {
+	ttl, ok := singletons[j.Type]
+	if !ok {
+		return func() {}, nil
+	}
+	key := singletonKey(j)
+	acquired, err := locker.Acquire("scheduled:"+key, j.ID, scheduleTTL(j, ttl))
+	if err != nil {
+		return nil, err
+	}
+	if !acquired {
+		return nil, ErrLocked
+	}
+	acquired, err = locker.Acquire("running:"+key, j.ID, ttl)
+	if err != nil {
+		return nil, err
+	}
+	if !acquired {
+		return nil, ErrLocked
+	}
+	return func() {
+		err := locker.Release("running:"+key, j.ID)
+		if err != nil {
+			log.Print("error releasing execution lock: ", err)
+		}
+	}, nil
+}
@@ -0,0 +1,129 @@
+package jobs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/betacraft/scheduler/lock"
+)
+
+// recordDoer keeps the enqueued jobs
+type recordDoer struct {
+	jobs []*Job
+	err  error
+}
+
+func (d *recordDoer) Enqueue(j *Job) error {
+	if d.err != nil {
+		return d.err
+	}
+	d.jobs = append(d.jobs, j)
+	return nil
+}
+
+func (d *recordDoer) Monitor(c Config) {}
+
+func useDoer(t *testing.T, d Doer) {
+	prev := RegisteredDoer()
+	RegisterDoer(d)
+	t.Cleanup(func() { RegisterDoer(prev) })
+}
+
+func useLocker(t *testing.T) *lock.MemoryLocker {
+	prev := locker
+	l := lock.NewMemoryLocker()
+	l.Now = Now
+	RegisterLocker(l)
+	t.Cleanup(func() { RegisterLocker(prev) })
+	return l
+}
+
+func TestSingletonSchedule(t *testing.T) {
+	useDoer(t, &recordDoer{})
+	useLocker(t)
+	RegisterSingleton("TestSingleton", time.Minute)
+	RegisterExecutor("TestSingleton", &funcExecutor{})
+
+	a := &Job{ID: "a", Type: "TestSingleton", Queue: "q", Interval: 1000}
+	if err := Enqueue(a); err != nil {
+		t.Fatal(err)
+	}
+	b := &Job{ID: "b", Type: "TestSingleton", Queue: "q", Interval: 1000}
+	if err := Enqueue(b); err != ErrAlreadyScheduled {
+		t.Errorf("got %v, want ErrAlreadyScheduled", err)
+	}
+	// another key is another singleton
+	b.SingletonKey = "tenant-2"
+	if err := Enqueue(b); err != nil {
+		t.Errorf("got %v for another key", err)
+	}
+
+	// the job holding the schedule lock runs, and releases it once done
+	if err := Execute(&Job{ID: "c", Type: "TestSingleton", Queue: "q"}); err != ErrLocked {
+		t.Errorf("got %v for a copy not holding the lock, want ErrLocked", err)
+	}
+	if action, err := Process(a); action != ActionDone || err != nil {
+		t.Fatalf("got %s, %v", action, err)
+	}
+	c := &Job{ID: "c", Type: "TestSingleton", Queue: "q", Interval: 1000}
+	if err := Enqueue(c); err != nil {
+		t.Errorf("got %v once the scheduled job ran", err)
+	}
+}
+
+func TestSingletonRunning(t *testing.T) {
+	useDoer(t, &recordDoer{})
+	l := useLocker(t)
+	RegisterSingleton("TestSingletonRunning", time.Minute)
+	RegisterExecutor("TestSingletonRunning", &funcExecutor{})
+
+	j := &Job{ID: "a", Type: "TestSingletonRunning", Queue: "q", Interval: 1000}
+	if err := Enqueue(j); err != nil {
+		t.Fatal(err)
+	}
+	// i.e. a copy redelivered while the job runs on another consumer
+	l.Acquire("running:TestSingletonRunning", "other", time.Minute)
+	if action, err := Process(j); action != ActionDrop || err != ErrLocked {
+		t.Errorf("got %s, %v, want ErrLocked while running", action, err)
+	}
+}
+
+func TestSingletonEnqueueError(t *testing.T) {
+	useDoer(t, &recordDoer{err: ErrNoDoer})
+	useLocker(t)
+	RegisterSingleton("TestSingletonError", time.Minute)
+	RegisterExecutor("TestSingletonError", &funcExecutor{})
+
+	j := &Job{ID: "a", Type: "TestSingletonError", Queue: "q", Interval: 1000}
+	if err := Enqueue(j); err != ErrNoDoer {
+		t.Fatalf("got %v", err)
+	}
+	useDoer(t, &recordDoer{})
+	j.ID = "b"
+	if err := Enqueue(j); err != nil {
+		t.Errorf("schedule lock kept after failing to enqueue: %v", err)
+	}
+}
+
+func TestSingletonSettledDeadLetter(t *testing.T) {
+	s := mapStore{}
+	RegisterStore(s)
+	defer RegisterStore(nil)
+	useDoer(t, &recordDoer{})
+	useLocker(t)
+	RegisterSingleton("TestSingletonDead", time.Minute)
+	RegisterExecutor("TestSingletonDead", &funcExecutor{})
+
+	j := &Job{ID: "a", Type: "TestSingletonDead", Queue: "q", Interval: 1000}
+	if err := Enqueue(j); err != nil {
+		t.Fatal(err)
+	}
+	// i.e. dead-lettered as it could not be enqueued again after a retry
+	Settled(j, ActionDeadLetter, ErrNoDoer)
+	if s["a"].Status != StatusDead {
+		t.Errorf("got %s, want dead", s["a"].Status)
+	}
+	if err := Enqueue(&Job{ID: "b", Type: "TestSingletonDead", Queue: "q", Interval: 1000}); err != nil {
+		t.Errorf("schedule lock kept by the dead-lettered job: %v", err)
+	}
+}
@@ -0,0 +1,220 @@
+package jobs
+
+import (
+	"errors"
+	"log"
+	"time"
+)
+
+// Status of a job as kept in the Store
+type Status string
+
+const (
+	StatusScheduled Status = "scheduled"
+	StatusRunning   Status = "running"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+	StatusCancelled Status = "cancelled"
+
+	// the job cannot be executed, and has been dead-lettered
+	StatusDead Status = "dead"
+)
+
+var (
+	// Returned by Store.Get when no record is found for the job ID
+	ErrNotFound = errors.New("job not found")
+
+	// Returned by Execute when the job has been cancelled
+	ErrCancelled = errors.New("job cancelled")
+
+	// Returned when a Store is required, but none is registered
+	ErrNoStore = errors.New("no job store registered")
+
+	// Returned by Retry for jobs which are scheduled or running
+	ErrJobActive = errors.New("job is scheduled or running")
+)
+
+// Record is the state of a job kept in the Store
+type Record struct {
+	Job *Job `json:"job"`
+
+	Status Status `json:"status"`
+
+	// Name of the Schedule the job was created for,
+	// empty if the job was not created by Reconcile
+	Schedule string `json:"schedule,omitempty"`
+
+	// Error returned by the last execution of the job
+	Error string `json:"error,omitempty"`
+
+	// Progress, from 0 to 100, and message reported by the running job
+	Progress        int    `json:"progress,omitempty"`
+	ProgressMessage string `json:"progress_message,omitempty"`
+
+	// Time of the last heartbeat of the running job
+	HeartbeatAt time.Time `json:"heartbeat_at,omitempty"`
+
+	// Outcome of the last execution of the job, kept once a recurring
+	// job is scheduled again, unlike Status and Error
+	LastRunAt  time.Time `json:"last_run_at,omitempty"`
+	LastStatus Status    `json:"last_status,omitempty"`
+	LastError  string    `json:"last_error,omitempty"`
+
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Store keeps the state of the jobs, outside of the queues.
+// Check the store package for the implementations.
+type Store interface {
+	// Save creates or replaces the record for r.Job.ID
+	Save(r *Record) error
+
+	// Get returns ErrNotFound if there is no record for the id
+	Get(id string) (*Record, error)
+
+	// List returns all the records
+	List() ([]*Record, error)
+
+	Delete(id string) error
+}
+
+var store Store
+
+// RegisterStore sets the store used for keeping the job states,
+// it should be shared by the publishers and consumers.
+func RegisterStore(s Store) {
+	store = s
+}
+
+// Cancel marks the job as cancelled in the store, a cancelled job is
+// not executed when received by a consumer, and hence never recurs.
+func Cancel(id string) error {
+	if store == nil {
+		return ErrNoStore
+	}
+	r, err := store.Get(id)
+	if err != nil {
+		return err
+	}
+	r.Status = StatusCancelled
+	r.UpdatedAt = Now()
+	return store.Save(r)
+}
+
+// Retry enqueues a failed, cancelled or finished job again,
+// with its ExecTime set to now.
+func Retry(id string) error {
+	if store == nil {
+		return ErrNoStore
+	}
+	r, err := store.Get(id)
+	if err != nil {
+		return err
+	}
+	if r.Status == StatusScheduled || r.Status == StatusRunning {
+		return ErrJobActive
+	}
+	// un-cancel before enqueueing, setStatus never changes the status
+	// of a cancelled job, and a cancelled job is dropped once received
+	prev := *r
+	j := *r.Job
+	prev.Job = &j
+	r.Status = StatusScheduled
+	r.Error = ""
+	r.UpdatedAt = Now()
+	r.Job.ExecTime = r.UpdatedAt
+	err = store.Save(r)
+	if err != nil {
+		return err
+	}
+	err = Enqueue(r.Job)
+	if err != nil {
+		// not scheduled, the job can be retried again
+		if serr := store.Save(&prev); serr != nil {
+			log.Print("error restoring the record of the job: ", serr)
+		}
+		return err
+	}
+	return nil
+}
+
+// GetRecord returns the record of the job from the registered store
+func GetRecord(id string) (*Record, error) {
+	if store == nil {
+		return nil, ErrNoStore
+	}
+	return store.Get(id)
+}
+
+// ListRecords returns all the records from the registered store
+func ListRecords() ([]*Record, error) {
+	if store == nil {
+		return nil, ErrNoStore
+	}
+	return store.List()
+}
+
+// setStatus updates the record of the job, if a store is registered.
+// The status of a cancelled job is never changed.
+func setStatus(j *Job, status Status, cause error) {
+	if store == nil {
+		return
+	}
+	r, err := store.Get(j.ID)
+	if err != nil {
+		r = &Record{}
+	}
+	if r.Status == StatusCancelled {
+		return
+	}
+	r.Job = j
+	r.Status = status
+	r.Error = ""
+	if cause != nil {
+		r.Error = cause.Error()
+	}
+	if status == StatusRunning {
+		r.Progress = 0
+		r.ProgressMessage = ""
+	}
+	r.UpdatedAt = Now()
+	switch status {
+	case StatusSucceeded, StatusFailed, StatusDead:
+		r.LastRunAt = r.UpdatedAt
+		r.LastStatus = status
+		r.LastError = r.Error
+	}
+	err = store.Save(r)
+	if err != nil {
+		log.Print("error saving job status: ", j.ID, " ", err)
+	}
+}
+
+// updateRecord applies update to the record of the job, if a store is
+// registered and the record exists
+func updateRecord(j *Job, update func(r *Record)) {
+	if store == nil {
+		return
+	}
+	r, err := store.Get(j.ID)
+	if err != nil {
+		return
+	}
+	update(r)
+	r.UpdatedAt = Now()
+	err = store.Save(r)
+	if err != nil {
+		log.Printf("error saving job record, JobID: %s: %v", j.ID, err)
+	}
+}
+
+func isCancelled(j *Job) bool {
+	if store == nil {
+		return false
+	}
+	r, err := store.Get(j.ID)
+	if err != nil {
+		return false
+	}
+	return r.Status == StatusCancelled
+}
@@ -0,0 +1,59 @@
+package jobs
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRetryEnqueueError(t *testing.T) {
+	s := mapStore{}
+	RegisterStore(s)
+	defer RegisterStore(nil)
+	RegisterExecutor("TestRetry", &funcExecutor{})
+	down := errors.New("broker down")
+	useDoer(t, &recordDoer{err: down})
+
+	for _, status := range []Status{StatusFailed, StatusCancelled} {
+		j := &Job{ID: "1", Type: "TestRetry", Queue: "q"}
+		s.Save(&Record{Job: j, Status: status, Error: "boom"})
+		if err := Retry("1"); err != down {
+			t.Fatalf("got %v, want the enqueue error", err)
+		}
+		r, _ := s.Get("1")
+		if r.Status != status || r.Error != "boom" || !r.Job.ExecTime.IsZero() {
+			t.Errorf("got %s, %q, %v, want the %s record restored", r.Status, r.Error, r.Job.ExecTime, status)
+		}
+	}
+
+	d := &recordDoer{}
+	useDoer(t, d)
+	if err := Retry("1"); err != nil {
+		t.Fatal(err)
+	}
+	r, _ := s.Get("1")
+	if r.Status != StatusScheduled || len(d.jobs) != 1 {
+		t.Errorf("got %s with %d jobs enqueued", r.Status, len(d.jobs))
+	}
+	if err := Retry("1"); err != ErrJobActive {
+		t.Errorf("got %v for a scheduled job, want ErrJobActive", err)
+	}
+}
+
+func TestLastRunKept(t *testing.T) {
+	s := mapStore{}
+	RegisterStore(s)
+	defer RegisterStore(nil)
+
+	j := &Job{ID: "1", Type: "TestLastRun", Queue: "q"}
+	setStatus(j, StatusRunning, nil)
+	setStatus(j, StatusFailed, errors.New("boom"))
+	// a recurring job is scheduled again after its run
+	setStatus(j, StatusScheduled, nil)
+	r, _ := s.Get("1")
+	if r.Status != StatusScheduled || r.Error != "" {
+		t.Errorf("got %s, %q, want scheduled", r.Status, r.Error)
+	}
+	if r.LastStatus != StatusFailed || r.LastError != "boom" || r.LastRunAt.IsZero() {
+		t.Errorf("got %s, %q at %v, want the failed run kept", r.LastStatus, r.LastError, r.LastRunAt)
+	}
+}
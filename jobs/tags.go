@@ -0,0 +1,129 @@
+package jobs
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// Returned by Execute for a copy of a job which has since been
+// rescheduled, with RescheduleByTags, the copy is dropped
+var ErrSuperseded = errors.New("job rescheduled")
+
+// ParseTags parses tags in the form "key=value", as used in the
+// admin API, for eg: ParseTags([]string{"tenant=acme", "campaign=42"})
+func ParseTags(list []string) (map[string]string, error) {
+	tags := map[string]string{}
+	for _, v := range list {
+		kv := strings.SplitN(v, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, &ValidationError{Field: "Tags", Err: fmt.Errorf("%w: %q, expected key=value", ErrInvalidValue, v)}
+		}
+		tags[kv[0]] = kv[1]
+	}
+	return tags, nil
+}
+
+// HasTags returns true if the job has all the given tags
+func (j *Job) HasTags(tags map[string]string) bool {
+	for k, v := range tags {
+		if jv, ok := j.Tags[k]; !ok || jv != v {
+			return false
+		}
+	}
+	return true
+}
+
+// FindByTags returns the records of the jobs with all the given tags,
+// from the registered store. All the records are returned if tags is empty.
+func FindByTags(tags map[string]string) ([]*Record, error) {
+	records, err := ListRecords()
+	if err != nil {
+		return nil, err
+	}
+	list := []*Record{}
+	for _, r := range records {
+		if r.Job != nil && r.Job.HasTags(tags) {
+			list = append(list, r)
+		}
+	}
+	return list, nil
+}
+
+// CancelByTags cancels the scheduled and running jobs with all the given
+// tags, and returns the number of jobs cancelled. At least one tag is
+// required, to not cancel every job by mistake.
+func CancelByTags(tags map[string]string) (int, error) {
+	if len(tags) == 0 {
+		return 0, &ValidationError{Field: "Tags", Err: ErrMissingField}
+	}
+	records, err := FindByTags(tags)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, r := range records {
+		if r.Status != StatusScheduled && r.Status != StatusRunning {
+			continue
+		}
+		err = Cancel(r.Job.ID)
+		if err != nil {
+			return n, err
+		}
+		n++
+	}
+	log.Printf("cancelled %d jobs with tags %v", n, tags)
+	return n, nil
+}
+
+// RescheduleByTags moves the scheduled jobs with all the given tags to
+// execTime, and returns the number of jobs rescheduled. The jobs are
+// enqueued again, the copies already in the queues are dropped when
+// received, as they are superseded.
+func RescheduleByTags(tags map[string]string, execTime time.Time) (int, error) {
+	if len(tags) == 0 {
+		return 0, &ValidationError{Field: "Tags", Err: ErrMissingField}
+	}
+	records, err := FindByTags(tags)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, r := range records {
+		if r.Status != StatusScheduled {
+			continue
+		}
+		// a copy, the store must not see the new time before it is enqueued
+		j := *r.Job
+		j.ExecTime = execTime
+		err = Enqueue(&j)
+		if err != nil {
+			return n, err
+		}
+		n++
+	}
+	log.Printf("rescheduled %d jobs with tags %v to %s", n, tags, execTime)
+	return n, nil
+}
+
+// IsStale returns true if the job has been cancelled or rescheduled since
+// this copy of it was enqueued. Queue implementations which enqueue a job
+// again before it is due, like sqs, should drop the stale copies instead.
+func IsStale(j *Job) bool {
+	return isCancelled(j) || isSuperseded(j)
+}
+
+// isSuperseded is true if the job is scheduled in the store,
+// at a time other than that of this copy
+func isSuperseded(j *Job) bool {
+	if store == nil {
+		return false
+	}
+	r, err := store.Get(j.ID)
+	if err != nil || r.Job == nil {
+		return false
+	}
+	return r.Status == StatusScheduled && !r.Job.ExecTime.Equal(j.ExecTime)
+}
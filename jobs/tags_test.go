@@ -0,0 +1,103 @@
+package jobs
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// tagStore has jobs 1 and 2 of tenant acme, 1 in campaign 42,
+// and job 3 of another tenant
+func tagStore(t *testing.T) mapStore {
+	s := mapStore{}
+	RegisterStore(s)
+	t.Cleanup(func() { RegisterStore(nil) })
+	RegisterType("TestTags")
+	at := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for id, tags := range map[string]map[string]string{
+		"1": {"tenant": "acme", "campaign": "42"},
+		"2": {"tenant": "acme"},
+		"3": {"tenant": "other"},
+	} {
+		s.Save(&Record{Job: &Job{ID: id, Type: "TestTags", ExecTime: at, Tags: tags}, Status: StatusScheduled})
+	}
+	return s
+}
+
+func TestFindByTags(t *testing.T) {
+	tagStore(t)
+	cases := []struct {
+		tags map[string]string
+		n    int
+	}{
+		{map[string]string{"tenant": "acme"}, 2},
+		{map[string]string{"tenant": "acme", "campaign": "42"}, 1},
+		{map[string]string{"tenant": "none"}, 0},
+		{nil, 3},
+	}
+	for _, c := range cases {
+		list, err := FindByTags(c.tags)
+		if err != nil || len(list) != c.n {
+			t.Errorf("%v: got %d records, %v, want %d", c.tags, len(list), err, c.n)
+		}
+	}
+}
+
+func TestCancelByTags(t *testing.T) {
+	s := tagStore(t)
+	s["2"].Status = StatusSucceeded
+	if _, err := CancelByTags(nil); !errors.Is(err, ErrMissingField) {
+		t.Errorf("got %v, want the tags required", err)
+	}
+	n, err := CancelByTags(map[string]string{"tenant": "acme"})
+	if n != 1 || err != nil {
+		t.Fatalf("got %d, %v, want 1 cancelled", n, err)
+	}
+	want := map[string]Status{"1": StatusCancelled, "2": StatusSucceeded, "3": StatusScheduled}
+	for id, status := range want {
+		if s[id].Status != status {
+			t.Errorf("job %s is %s, want %s", id, s[id].Status, status)
+		}
+	}
+}
+
+func TestRescheduleByTags(t *testing.T) {
+	s := tagStore(t)
+	d := &recordDoer{}
+	useDoer(t, d)
+	at := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	if _, err := RescheduleByTags(nil, at); !errors.Is(err, ErrMissingField) {
+		t.Errorf("got %v, want the tags required", err)
+	}
+	n, err := RescheduleByTags(map[string]string{"tenant": "acme"}, at)
+	if n != 2 || err != nil || len(d.jobs) != 2 {
+		t.Fatalf("got %d, %v with %d jobs enqueued, want 2 rescheduled", n, err, len(d.jobs))
+	}
+	for _, id := range []string{"1", "2"} {
+		if !s[id].Job.ExecTime.Equal(at) {
+			t.Errorf("job %s at %v, want %v", id, s[id].Job.ExecTime, at)
+		}
+	}
+	if s["3"].Job.ExecTime.Equal(at) {
+		t.Error("job of another tenant rescheduled")
+	}
+}
+
+func TestRescheduleByTagsEnqueueError(t *testing.T) {
+	s := tagStore(t)
+	down := errors.New("broker down")
+	useDoer(t, &recordDoer{err: down})
+	before := *s["1"].Job
+	n, err := RescheduleByTags(map[string]string{"campaign": "42"}, time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	if n != 0 || err != down {
+		t.Fatalf("got %d, %v, want the enqueue error", n, err)
+	}
+	r, _ := s.Get("1")
+	if r.Status != StatusScheduled || !r.Job.ExecTime.Equal(before.ExecTime) {
+		t.Errorf("got %s at %v, want the record unchanged", r.Status, r.Job.ExecTime)
+	}
+	// the copy in the queue is not superseded
+	if IsStale(&before) {
+		t.Error("job stale after a failed reschedule")
+	}
+}
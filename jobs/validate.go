@@ -0,0 +1,78 @@
+package jobs
+
+import "errors"
+
+var (
+	// A required field of the job is empty
+	ErrMissingField = errors.New("required field missing")
+
+	// A field of the job has a value not allowed
+	ErrInvalidValue = errors.New("invalid value")
+
+	// No executor, or type, is registered for the job type
+	ErrUnknownExecutor = errors.New("unknown executor")
+)
+
+// ValidationError is returned by Enqueue for an invalid job, Err is one
+// of the errors above, or of the queue implementation, for eg:
+//  if errors.Is(err, jobs.ErrUnknownExecutor) { ... }
+//  var verr *jobs.ValidationError
+//  if errors.As(err, &verr) { log.Print("invalid field: ", verr.Field) }
+type ValidationError struct {
+	// Name of the field of the Job struct
+	Field string
+
+	Err error
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid job, " + e.Field + ": " + e.Err.Error()
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// Validator is implemented by the Doers which have requirements of their
+// own for the jobs, it should return a *ValidationError for an invalid job.
+type Validator interface {
+	Validate(j *Job) error
+}
+
+// job types known in this process, either with an executor or without
+var knownTypes map[string]bool
+
+func init() {
+	knownTypes = map[string]bool{}
+}
+
+// RegisterType makes a job type known, without an executor. It is meant
+// for processes which only enqueue jobs, and leave the execution to
+// other processes.
+func RegisterType(jobType string) {
+	knownTypes[jobType] = true
+}
+
+// Validate checks the job for the requirements common to all the queue
+// implementations, and for those of the registered Doer.
+// It is called by Enqueue, before the job is submitted.
+func Validate(j *Job) error {
+	switch {
+	case j.ID == "":
+		return &ValidationError{Field: "ID", Err: ErrMissingField}
+	case j.Type == "":
+		return &ValidationError{Field: "Type", Err: ErrMissingField}
+	case !knownTypes[j.Type]:
+		return &ValidationError{Field: "Type", Err: ErrUnknownExecutor}
+	case j.Interval < 0:
+		return &ValidationError{Field: "Interval", Err: ErrInvalidValue}
+	case j.MaxAttempts < 0:
+		return &ValidationError{Field: "MaxAttempts", Err: ErrInvalidValue}
+	case j.IsRecurring && j.Interval == 0: // would recur without a pause
+		return &ValidationError{Field: "Interval", Err: ErrMissingField}
+	}
+	if v, ok := doer.(Validator); ok {
+		return v.Validate(j)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package jobs
+
+import (
+	"errors"
+	"testing"
+)
+
+// queueDoer requires a Queue
+type queueDoer struct {
+	recordDoer
+}
+
+func (d *queueDoer) Validate(j *Job) error {
+	if j.Queue == "" {
+		return &ValidationError{Field: "Queue", Err: ErrMissingField}
+	}
+	return nil
+}
+
+func TestValidate(t *testing.T) {
+	RegisterType("TestValidate")
+	useDoer(t, &queueDoer{})
+	cases := []struct {
+		job   Job
+		field string
+		err   error
+	}{
+		{Job{ID: "1", Type: "TestValidate", Queue: "q"}, "", nil},
+		{Job{Type: "TestValidate", Queue: "q"}, "ID", ErrMissingField},
+		{Job{ID: "1", Queue: "q"}, "Type", ErrMissingField},
+		{Job{ID: "1", Type: "TestUnknown", Queue: "q"}, "Type", ErrUnknownExecutor},
+		{Job{ID: "1", Type: "TestValidate", Queue: "q", Interval: -1}, "Interval", ErrInvalidValue},
+		{Job{ID: "1", Type: "TestValidate", Queue: "q", MaxAttempts: -1}, "MaxAttempts", ErrInvalidValue},
+		{Job{ID: "1", Type: "TestValidate", Queue: "q", IsRecurring: true}, "Interval", ErrMissingField},
+		{Job{ID: "1", Type: "TestValidate"}, "Queue", ErrMissingField},
+	}
+	for _, c := range cases {
+		err := Validate(&c.job)
+		if c.err == nil {
+			if err != nil {
+				t.Errorf("%+v: got %v", c.job, err)
+			}
+			continue
+		}
+		var verr *ValidationError
+		if !errors.As(err, &verr) || verr.Field != c.field || !errors.Is(err, c.err) {
+			t.Errorf("%+v: got %v, want %s: %v", c.job, err, c.field, c.err)
+		}
+	}
+}
+
+func TestEnqueueInvalid(t *testing.T) {
+	d := &queueDoer{}
+	useDoer(t, d)
+	RegisterType("TestValidate")
+	err := Enqueue(&Job{ID: "1", Type: "TestValidate"})
+	if !errors.Is(err, ErrMissingField) || len(d.jobs) != 0 {
+		t.Errorf("got %v with %d jobs enqueued, want the job rejected", err, len(d.jobs))
+	}
+}
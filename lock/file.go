@@ -0,0 +1,162 @@
+package lock
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FileLocker keeps every lock as a file in Dir, it can be used by
+// processes running on the same host, or sharing Dir over a filesystem
+// which supports exclusive file creation.
+type FileLocker struct {
+	Dir string
+
+	// Now is used for expiring the locks, time.Now by default,
+	// it can be replaced with a fake clock for tests
+	Now func() time.Time
+}
+
+// NewFileLocker creates dir if it does not exist
+func NewFileLocker(dir string) (*FileLocker, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	return &FileLocker{Dir: dir, Now: time.Now}, nil
+}
+
+func (l *FileLocker) now() time.Time {
+	if l.Now == nil {
+		return time.Now()
+	}
+	return l.Now()
+}
+
+func (l *FileLocker) Acquire(key, owner string, ttl time.Duration) (bool, error) {
+	path := l.path(key)
+	now := l.now()
+	content := fmt.Sprintf("%s\n%d", owner, now.Add(ttl).UnixNano())
+	for i := 0; i < 2; i++ {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			_, err = f.WriteString(content)
+			f.Close()
+			if err != nil {
+				os.Remove(path)
+				return false, err
+			}
+			return true, nil
+		}
+		if !os.IsExist(err) {
+			return false, err
+		}
+
+		// lock file exists, check whether it is ours or has expired
+		b, err := ioutil.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue // released in the meanwhile, try again
+		}
+		if err != nil {
+			return false, err
+		}
+		holder, expires, err := parseLockFile(b, now)
+		if err != nil {
+			return false, err
+		}
+		if holder == owner {
+			return true, ioutil.WriteFile(path, []byte(content), 0644)
+		}
+		if now.Before(expires) {
+			return false, nil
+		}
+
+		// expired, remove it and retry, unless another contender
+		// has taken it over since it was read
+		removed, err := removeStale(path, b)
+		if err != nil {
+			return false, err
+		}
+		if !removed {
+			return false, nil
+		}
+	}
+	return false, nil
+}
+
+// removeStale removes the lock file at path if it still holds the expired
+// lock read, and returns whether it did. The file is moved out of the way
+// first, so that only one of the contenders gets it, and is put back if it
+// is the fresh lock of a contender which removed the expired one already.
+func removeStale(path string, read []byte) (bool, error) {
+	stale := fmt.Sprintf("%s.%s.stale", path, strconv.FormatInt(time.Now().UnixNano(), 36))
+	err := os.Rename(path, stale)
+	if os.IsNotExist(err) {
+		return true, nil // removed by another contender, try again
+	}
+	if err != nil {
+		return false, err
+	}
+	moved, err := ioutil.ReadFile(stale)
+	if err != nil || string(moved) == string(read) {
+		os.Remove(stale)
+		return true, nil
+	}
+	// Link, unlike Rename, does not replace a lock created in the instant
+	// the path was free, the fresh lock is then lost, the only case two
+	// owners may hold the lock
+	err = os.Link(stale, path)
+	os.Remove(stale)
+	if err != nil && !os.IsExist(err) {
+		return false, err
+	}
+	return false, nil
+}
+
+func (l *FileLocker) Release(key, owner string) error {
+	path := l.path(key)
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	holder, _, err := parseLockFile(b, l.now())
+	if err != nil {
+		return err
+	}
+	if holder != owner {
+		return nil
+	}
+	err = os.Remove(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// keys may contain characters which are not allowed in file names
+func (l *FileLocker) path(key string) string {
+	sum := sha1.Sum([]byte(key))
+	return filepath.Join(l.Dir, hex.EncodeToString(sum[:])+".lock")
+}
+
+func parseLockFile(b []byte, now time.Time) (string, time.Time, error) {
+	parts := strings.SplitN(string(b), "\n", 2)
+	if len(parts) != 2 {
+		// partially written, treat it as held for now
+		return "", now.Add(time.Second), nil
+	}
+	nsec, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return parts[0], time.Unix(0, nsec), nil
+}
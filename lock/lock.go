@@ -0,0 +1,23 @@
+// Package lock provides the distributed locks used by the scheduler to run
+// singleton jobs. Three implementations are available, an in-memory one for
+// a single process, a file based one for processes sharing a filesystem and
+// one for Redis compatible servers for everything else.
+package lock
+
+import "time"
+
+// Locker is implemented by all the lock backends.
+// A lock is identified by its key and is held by an owner, the owner
+// is usually the ID of the job holding the lock. Locks always expire after
+// the ttl passed while acquiring them, so a crashed worker cannot hold a
+// lock forever.
+type Locker interface {
+	// Acquire takes the lock on key for owner, returns false if the lock
+	// is held by some other owner. If owner already holds the lock, its
+	// ttl is extended and true is returned.
+	Acquire(key, owner string, ttl time.Duration) (bool, error)
+
+	// Release frees the lock on key, if held by owner,
+	// releasing a lock held by some other owner is a no-op.
+	Release(key, owner string) error
+}
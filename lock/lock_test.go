@@ -0,0 +1,273 @@
+package lock
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is advanced by the tests
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// testLocker checks the behaviour common to all the lockers,
+// advance moves the clock the locks expire on
+func testLocker(t *testing.T, l Locker, advance func(time.Duration)) {
+	ok, err := l.Acquire("k", "a", time.Minute)
+	if !ok || err != nil {
+		t.Fatalf("acquire free lock: got %t, %v", ok, err)
+	}
+	if ok, _ := l.Acquire("k", "b", time.Minute); ok {
+		t.Error("lock held by a acquired by b")
+	}
+	if ok, _ := l.Acquire("k", "a", time.Minute); !ok {
+		t.Error("owner could not extend its lock")
+	}
+	if ok, _ := l.Acquire("other", "b", time.Minute); !ok {
+		t.Error("lock on another key not acquired")
+	}
+
+	// releasing a lock held by another owner is a no-op
+	if err := l.Release("k", "b"); err != nil {
+		t.Error(err)
+	}
+	if ok, _ := l.Acquire("k", "b", time.Minute); ok {
+		t.Error("lock released by another owner")
+	}
+	if err := l.Release("k", "a"); err != nil {
+		t.Error(err)
+	}
+	if ok, _ := l.Acquire("k", "b", time.Minute); !ok {
+		t.Error("released lock not acquired")
+	}
+
+	advance(2 * time.Minute)
+	if ok, _ := l.Acquire("k", "c", time.Minute); !ok {
+		t.Error("expired lock not acquired")
+	}
+	if ok, _ := l.Acquire("k", "b", time.Minute); ok {
+		t.Error("lock taken over by its expired owner")
+	}
+}
+
+func TestMemoryLocker(t *testing.T) {
+	c := &fakeClock{now: time.Now()}
+	l := NewMemoryLocker()
+	l.Now = c.Now
+	testLocker(t, l, c.Advance)
+}
+
+func newFileLocker(t *testing.T) (*FileLocker, *fakeClock) {
+	dir, err := ioutil.TempDir("", "lock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	l, err := NewFileLocker(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &fakeClock{now: time.Now()}
+	l.Now = c.Now
+	return l, c
+}
+
+func TestFileLocker(t *testing.T) {
+	l, c := newFileLocker(t)
+	testLocker(t, l, c.Advance)
+}
+
+func TestFileLockerStaleTakeover(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		l, c := newFileLocker(t)
+		l.Acquire("k", "old", time.Minute)
+		c.Advance(2 * time.Minute)
+
+		// contenders race for the expired lock, one of them only gets it
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		winners := []string{}
+		for n := 0; n < 8; n++ {
+			wg.Add(1)
+			go func(owner string) {
+				defer wg.Done()
+				ok, err := l.Acquire("k", owner, time.Minute)
+				if err != nil {
+					t.Error(err)
+				}
+				if ok {
+					mu.Lock()
+					winners = append(winners, owner)
+					mu.Unlock()
+				}
+			}(strconv.Itoa(n))
+		}
+		wg.Wait()
+		if len(winners) > 1 {
+			t.Fatalf("lock acquired by %v", winners)
+		}
+		if len(winners) == 1 {
+			holder, _, _ := parseLockFile(mustRead(t, l.path("k")), c.Now())
+			if holder != winners[0] {
+				t.Fatalf("lock acquired by %s, held by %s", winners[0], holder)
+			}
+		}
+	}
+}
+
+func TestRemoveStale(t *testing.T) {
+	l, c := newFileLocker(t)
+	l.Acquire("k", "old", time.Minute)
+	path := l.path("k")
+	expired := mustRead(t, path)
+
+	// taken over by another contender since it was read
+	c.Advance(2 * time.Minute)
+	os.Remove(path)
+	l.Acquire("k", "fresh", time.Minute)
+	removed, err := removeStale(path, expired)
+	if removed || err != nil {
+		t.Fatalf("got %t, %v, want the fresh lock kept", removed, err)
+	}
+	if ok, _ := l.Acquire("k", "late", time.Minute); ok {
+		t.Error("fresh lock taken over")
+	}
+	holder, _, _ := parseLockFile(mustRead(t, path), c.Now())
+	if holder != "fresh" {
+		t.Errorf("lock held by %q, want fresh", holder)
+	}
+
+	removed, err = removeStale(path, mustRead(t, path))
+	if !removed || err != nil {
+		t.Fatalf("got %t, %v, want the expired lock removed", removed, err)
+	}
+	if _, err = os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expired lock not removed: %v", err)
+	}
+}
+
+func mustRead(t *testing.T, path string) []byte {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// fakeRedis serves the acquire and release scripts of RedisLocker,
+// keeping the locks on its own clock
+type fakeRedis struct {
+	clock *fakeClock
+	mu    sync.Mutex
+	locks map[string]entry
+}
+
+func (r *fakeRedis) serve(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			rd := bufio.NewReader(conn)
+			for {
+				args, err := readCommand(rd)
+				if err != nil {
+					return
+				}
+				io.WriteString(conn, ":"+strconv.Itoa(r.eval(args))+"\r\n")
+			}
+		}()
+	}
+}
+
+// eval runs EVAL script 1 key owner [ttl]
+func (r *fakeRedis) eval(args []string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	script, key, owner := args[1], args[3], args[4]
+	now := r.clock.Now()
+	e, ok := r.locks[key]
+	held := ok && now.Before(e.expires)
+	switch script {
+	case acquireScript:
+		if held && e.owner != owner {
+			return 0
+		}
+		ms, _ := strconv.Atoi(args[5])
+		r.locks[key] = entry{owner: owner, expires: now.Add(time.Duration(ms) * time.Millisecond)}
+		return 1
+	case releaseScript:
+		if held && e.owner == owner {
+			delete(r.locks, key)
+			return 1
+		}
+	}
+	return 0
+}
+
+func readCommand(rd *bufio.Reader) ([]string, error) {
+	line, err := rd.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(line[1 : len(line)-2])
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		line, err = rd.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(line[1 : len(line)-2])
+		if err != nil {
+			return nil, err
+		}
+		b := make([]byte, size+2)
+		if _, err = io.ReadFull(rd, b); err != nil {
+			return nil, err
+		}
+		args[i] = string(b[:size])
+	}
+	return args, nil
+}
+
+func TestRedisLocker(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip("cannot listen: ", err)
+	}
+	defer ln.Close()
+	r := &fakeRedis{clock: &fakeClock{now: time.Now()}, locks: map[string]entry{}}
+	go r.serve(ln)
+
+	l := NewRedisLocker(ln.Addr().String(), "", 0)
+	defer l.Close()
+	testLocker(t, l, r.clock.Advance)
+	if _, ok := r.locks["scheduler:lock:k"]; !ok {
+		t.Errorf("keys not prefixed, got %v", r.locks)
+	}
+}
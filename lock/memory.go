@@ -0,0 +1,47 @@
+package lock
+
+import (
+	"sync"
+	"time"
+)
+
+type entry struct {
+	owner   string
+	expires time.Time
+}
+
+// MemoryLocker keeps the locks in memory, it is useful only when all
+// the publishers and consumers run in a single process, or for tests.
+type MemoryLocker struct {
+	// Now is used for expiring the locks, time.Now by default,
+	// it can be replaced with a fake clock for tests
+	Now func() time.Time
+
+	mu    sync.Mutex
+	locks map[string]entry
+}
+
+func NewMemoryLocker() *MemoryLocker {
+	return &MemoryLocker{Now: time.Now, locks: map[string]entry{}}
+}
+
+func (l *MemoryLocker) Acquire(key, owner string, ttl time.Duration) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.Now()
+	e, ok := l.locks[key]
+	if ok && e.owner != owner && now.Before(e.expires) {
+		return false, nil
+	}
+	l.locks[key] = entry{owner: owner, expires: now.Add(ttl)}
+	return true, nil
+}
+
+func (l *MemoryLocker) Release(key, owner string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if e, ok := l.locks[key]; ok && e.owner == owner {
+		delete(l.locks, key)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package lock
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/betacraft/scheduler/internal/resp"
+)
+
+// takes the lock if free, or extends it if owned by the caller
+const acquireScript = `
+local v = redis.call("GET", KEYS[1])
+if v == false or v == ARGV[1] then
+	redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+	return 1
+end
+return 0`
+
+// deletes the lock only if owned by the caller
+const releaseScript = `
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`
+
+// RedisLocker keeps the locks on a Redis compatible server,
+// it needs support for EVAL, which is available on most of them.
+type RedisLocker struct {
+	// Prefix is prepended to all the keys, "scheduler:lock:" by default
+	Prefix string
+
+	client *resp.Client
+}
+
+// NewRedisLocker takes the address of the server as host:port,
+// password may be empty and db is the database number to be selected.
+func NewRedisLocker(addr, password string, db int) *RedisLocker {
+	return &RedisLocker{Prefix: "scheduler:lock:", client: resp.NewClient(addr, password, db)}
+}
+
+func (l *RedisLocker) Acquire(key, owner string, ttl time.Duration) (bool, error) {
+	ms := int64(ttl / time.Millisecond)
+	if ms < 1 {
+		ms = 1
+	}
+	res, err := l.client.Do("EVAL", acquireScript, "1", l.Prefix+key, owner, strconv.FormatInt(ms, 10))
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.(int64)
+	return n == 1, nil
+}
+
+func (l *RedisLocker) Release(key, owner string) error {
+	_, err := l.client.Do("EVAL", releaseScript, "1", l.Prefix+key, owner)
+	return err
+}
+
+// Close closes the connection to the server
+func (l *RedisLocker) Close() error {
+	return l.client.Close()
+}
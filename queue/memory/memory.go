@@ -0,0 +1,134 @@
+// Package memory is a queue implementation keeping the jobs in the memory
+// of the process, for development and for processes which enqueue and
+// execute their own jobs. Jobs are lost on restart.
+package memory
+
+import (
+	"encoding/json"
+	"log"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/betacraft/scheduler/jobs"
+)
+
+// Number of jobs executed at a time by each Monitor
+var Workers = runtime.NumCPU()
+
+// Doer keeps a channel of due jobs per queue, a job is delivered to
+// its channel once its delay passes
+type Doer struct {
+	mu     sync.Mutex
+	queues map[string]chan []byte
+}
+
+func New() *Doer {
+	return &Doer{queues: map[string]chan []byte{}}
+}
+
+// Init registers a new in-memory implementation with the jobs package
+func Init() *Doer {
+	d := New()
+	jobs.RegisterDoer(d)
+	log.Print("registering job scheduler with memory")
+	return d
+}
+
+func (d *Doer) queue(name string) chan []byte {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	q, ok := d.queues[name]
+	if !ok {
+		q = make(chan []byte, 1024)
+		d.queues[name] = q
+	}
+	return q
+}
+
+// Validate checks for a Queue, the jobs are kept in a queue per name,
+// and only those of the monitored queues are executed
+func (d *Doer) Validate(j *jobs.Job) error {
+	if j.Queue == "" {
+		return &jobs.ValidationError{Field: "Queue", Err: jobs.ErrMissingField}
+	}
+	return nil
+}
+
+// Enqueue keeps the job as json, like the other implementations,
+// so that the executor never shares it with the publisher
+func (d *Doer) Enqueue(j *jobs.Job) error {
+	b, err := json.Marshal(j)
+	if err != nil {
+		return err
+	}
+	q := d.queue(j.Queue)
+	delay := j.Delay()
+	time.AfterFunc(delay, func() { q <- b })
+	log.Printf("Enqueued JobID: %s, JobType: %s, delay: %s", j.ID, j.Type, delay)
+	return nil
+}
+
+// Monitor executes the jobs of the queue as they become due, Workers at a
+// time. Jobs to be dead-lettered are sent to c.DeadLetterQueue, if set and
+// not full, or dropped. The dead letter queue holds 1024 jobs, unless it
+// is monitored too.
+func (d *Doer) Monitor(c jobs.Config) {
+	q := d.queue(c.QueueName)
+	free := make(chan bool, Workers)
+	for b := range q {
+		jobs.WaitWhilePaused(c.QueueName)
+		free <- true
+		go func(b []byte) {
+			defer func() { <-free }()
+			d.process(c, b)
+		}(b)
+	}
+}
+
+func (d *Doer) process(c jobs.Config, b []byte) {
+	j := &jobs.Job{}
+	err := json.Unmarshal(b, j)
+	if err != nil { // marshalled by Enqueue, never happens
+		log.Print("error unmarshalling job: ", err)
+		return
+	}
+	action, err := jobs.Process(j)
+	if err != nil {
+		log.Print("error executing job: ", err)
+	}
+	switch action {
+	case jobs.ActionRetry, jobs.ActionReschedule, jobs.ActionHold:
+		eerr := jobs.Enqueue(j)
+		if eerr != nil {
+			log.Print("error enqueuing job: ", eerr)
+			return
+		}
+		jobs.Settled(j, action, err)
+	case jobs.ActionDeadLetter:
+		if c.DeadLetterQueue == "" {
+			log.Printf("no dead letter queue, dropping JobID: %s, JobType: %s", j.ID, j.Type)
+			return
+		}
+		select {
+		case d.queue(c.DeadLetterQueue) <- b:
+			jobs.Settled(j, action, err)
+		default:
+			log.Printf("dead letter queue full, dropping JobID: %s, JobType: %s", j.ID, j.Type)
+		}
+	}
+}
+
+// Queues lists the queues jobs have been enqueued to, or monitored,
+// along with the number of due jobs waiting in them
+func (d *Doer) Queues() ([]jobs.QueueInfo, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	list := []jobs.QueueInfo{}
+	for name, q := range d.queues {
+		list = append(list, jobs.QueueInfo{Name: name, Messages: int64(len(q))})
+	}
+	sort.Slice(list, func(a, b int) bool { return list[a].Name < list[b].Name })
+	return list, nil
+}
@@ -0,0 +1,93 @@
+package memory
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/betacraft/scheduler/jobs"
+)
+
+// blockingExecutor counts the running executions, until release is closed
+type blockingExecutor struct {
+	mu       sync.Mutex
+	running  int
+	max      int
+	finished chan bool
+	release  chan bool
+	err      error
+}
+
+func (e *blockingExecutor) New() jobs.Executor { return e }
+func (e *blockingExecutor) Execute(j *jobs.Job) error {
+	e.mu.Lock()
+	e.running++
+	if e.running > e.max {
+		e.max = e.running
+	}
+	e.mu.Unlock()
+	<-e.release
+	e.mu.Lock()
+	e.running--
+	e.mu.Unlock()
+	e.finished <- true
+	return e.err
+}
+
+func TestMonitorWorkers(t *testing.T) {
+	defer func(w int) { Workers = w }(Workers)
+	Workers = 2
+	e := &blockingExecutor{finished: make(chan bool, 5), release: make(chan bool)}
+	jobs.RegisterExecutor("TestWorkers", e)
+	d := New()
+	go d.Monitor(jobs.Config{QueueName: "workers"})
+	for i := 0; i < 5; i++ {
+		err := d.Enqueue(&jobs.Job{ID: "w", Type: "TestWorkers", Queue: "workers"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(e.release)
+	for i := 0; i < 5; i++ {
+		<-e.finished
+	}
+	if e.max != 2 {
+		t.Errorf("got %d jobs running at a time, want 2", e.max)
+	}
+}
+
+func TestDeadLetterQueueFull(t *testing.T) {
+	e := &blockingExecutor{finished: make(chan bool, 1), release: make(chan bool), err: jobs.Permanent(errors.New("failed"))}
+	close(e.release)
+	jobs.RegisterExecutor("TestDeadLetter", e)
+	d := New()
+	dlq := d.queue("dead")
+	for len(dlq) < cap(dlq) {
+		dlq <- nil
+	}
+	c := jobs.Config{QueueName: "live", DeadLetterQueue: "dead"}
+	done := make(chan bool)
+	go func() {
+		d.process(c, []byte(`{"id":"d","type":"TestDeadLetter","queue":"live"}`))
+		done <- true
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("blocked on the full dead letter queue")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	d := New()
+	if err := d.Validate(&jobs.Job{Queue: "q"}); err != nil {
+		t.Error(err)
+	}
+	err := d.Validate(&jobs.Job{})
+	var verr *jobs.ValidationError
+	if !errors.As(err, &verr) || verr.Field != "Queue" {
+		t.Errorf("got %v, want the missing queue", err)
+	}
+}
@@ -0,0 +1,65 @@
+package rmq
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// AckMode decides how the deliveries of the jobs which failed, and are
+// neither retried nor rescheduled, are settled. The jobs retried, or
+// rescheduled, are enqueued again whatever the mode. Deliveries are never
+// settled before the executor returns, those of a consumer which dies
+// while running a job are redelivered.
+type AckMode int
+
+const (
+	// A delivery is acked once its job is processed, and the job is
+	// enqueued again, to be retried or for its next occurrence, as
+	// decided by the error returned by the executor. The default.
+	AckAfterProcess AckMode = iota
+
+	// A delivery is acked if the executor succeeds, else it is nacked and
+	// requeued, and redelivered right away, the scheduler does not
+	// enqueue the job again. A redelivered job which fails again is
+	// nacked without requeueing, as for AckOnSuccessDeadLetter, which
+	// includes the first failure of a job redelivered as its consumer died.
+	AckOnSuccessRequeue
+
+	// A delivery is acked if the executor succeeds, else it is nacked
+	// without requeueing, to the dead letter queue of the queue, if any
+	AckOnSuccessDeadLetter
+)
+
+// Ack is the acknowledgement mode of the consumers started by Monitor,
+// it is set by Configure from the ack_mode of the configuration
+var Ack = AckAfterProcess
+
+// Prefetch is the number of unacked deliveries each consumer gets at a
+// time, i.e. of jobs it runs at a time, it is set by Configure from the
+// prefetch of the configuration
+var Prefetch = runtime.NumCPU()
+
+func (m AckMode) String() string {
+	switch m {
+	case AckAfterProcess:
+		return "after_process"
+	case AckOnSuccessRequeue:
+		return "on_success_requeue"
+	case AckOnSuccessDeadLetter:
+		return "on_success_dead_letter"
+	}
+	return "unknown"
+}
+
+// ParseAckMode parses the names returned by String, "" is AckAfterProcess
+func ParseAckMode(s string) (AckMode, error) {
+	switch s {
+	case "", "after_process":
+		return AckAfterProcess, nil
+	case "on_success_requeue":
+		return AckOnSuccessRequeue, nil
+	case "on_success_dead_letter":
+		return AckOnSuccessDeadLetter, nil
+	}
+	return AckAfterProcess, fmt.Errorf("unknown ack mode %q", s)
+}
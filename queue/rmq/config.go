@@ -1,14 +1,79 @@
 package rmq
 
+import (
+	"sync"
+
+	"github.com/betacraft/scheduler/config"
+	"github.com/betacraft/scheduler/jobs"
+)
+
 // RMQConfig is used as the struct to keep a queue configuration.
 type RMQConfig struct {
+	// Exchange the queue is bound to, the one passed to Setup if empty
+	ExchangeName string
+
 	// Name of the queue to be created
 	QueueName string
 
 	// Routing Key for queue
 	RoutingKey string
+
+	// Optional, name of the queue to which the jobs which cannot be
+	// executed are dead-lettered, it is declared by Setup.
+	// Note that the dead letter queue of an existing queue cannot be
+	// changed, the queue must be deleted first.
+	DeadLetterQueue string
 }
 
 func NewRMQConfig(exchangeName, queueName, routingKey string) RMQConfig {
-	return RMQConfig{QueueName: queueName, RoutingKey: routingKey}
+	return RMQConfig{ExchangeName: exchangeName, QueueName: queueName, RoutingKey: routingKey}
+}
+
+// Route overrides where the jobs of a type are published
+type Route struct {
+	// Exchange the jobs are published to, instead of the default one
+	Exchange string
+
+	// Routing key of the jobs which have no RoutingKey of their own
+	RoutingKey string
+}
+
+var routesMu sync.RWMutex
+var routes = map[string]Route{}
+
+// exchange the jobs are published to, unless routed otherwise
+var exchange = config.DefaultExchange
+
+// SetExchange sets the exchange the jobs are published to, it is set
+// by Setup and Configure, and is "droidcloud" if neither is called
+func SetExchange(name string) {
+	routesMu.Lock()
+	defer routesMu.Unlock()
+	exchange = name
+}
+
+// SetRoute publishes the jobs of the type with the route, the exchange
+// must have been declared, with Setup, or by Configure
+func SetRoute(jobType string, r Route) {
+	routesMu.Lock()
+	defer routesMu.Unlock()
+	routes[jobType] = r
+}
+
+// route returns the exchange and the routing key for the job
+func route(j *jobs.Job) (string, string) {
+	routesMu.RLock()
+	defer routesMu.RUnlock()
+	ex, key := exchange, j.RoutingKey
+	r, ok := routes[j.Type]
+	if !ok {
+		return ex, key
+	}
+	if r.Exchange != "" {
+		ex = r.Exchange
+	}
+	if key == "" {
+		key = r.RoutingKey
+	}
+	return ex, key
 }
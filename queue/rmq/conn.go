@@ -0,0 +1,327 @@
+package rmq
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/betacraft/scheduler/jobs"
+	"github.com/streadway/amqp"
+)
+
+// State of the connection to rabbitmq
+type State int
+
+const (
+	// Not connected yet, or the connection was lost and is being re-established
+	StateDisconnected State = iota
+
+	StateConnected
+
+	// Closed with Close, it is not re-established
+	StateClosed
+)
+
+func (s State) String() string {
+	switch s {
+	case StateDisconnected:
+		return "disconnected"
+	case StateConnected:
+		return "connected"
+	case StateClosed:
+		return "closed"
+	}
+	return "unknown"
+}
+
+// Returned when the connection is down, while it is being re-established
+var ErrNotConnected = errors.New("not connected to rabbitmq")
+
+// The delay between the attempts to reconnect starts at MinBackoff,
+// and is doubled after each failed attempt, up to MaxBackoff
+var (
+	MinBackoff = time.Second
+	MaxBackoff = time.Minute
+)
+
+var connMu sync.RWMutex
+var conn *amqp.Connection
+var consumerCh, pubCh *amqp.Channel
+var state = StateDisconnected
+
+// closed when connected, replaced by a new one on disconnecting
+var connected = make(chan struct{})
+
+// listeners registered with NotifyState
+var listeners []chan State
+
+// url of the last dialled connection, used to reconnect
+var dialURL string
+
+// Gives the amqp connection i.e. rabbitmq connection
+// should be used as read only, should not be edited at the
+// user's side. It changes when the connection is re-established.
+func GetAMQPConn() *amqp.Connection {
+	connMu.RLock()
+	defer connMu.RUnlock()
+	return conn
+}
+
+// Gives the rabbitmq publisher channel
+// should be used as read only, should not be edited at the
+// user's side.
+func GetPubChannel() *amqp.Channel {
+	connMu.RLock()
+	defer connMu.RUnlock()
+	return pubCh
+}
+
+// Gives the rabbitmq consumer channel.
+// Should be used as read only, should not be edited at the
+// user's side.
+func GetConsumerChannel() *amqp.Channel {
+	connMu.RLock()
+	defer connMu.RUnlock()
+	return consumerCh
+}
+
+// ConnectionState returns the current state of the connection
+func ConnectionState() State {
+	connMu.RLock()
+	defer connMu.RUnlock()
+	return state
+}
+
+// NotifyState registers c to receive the state of the connection whenever
+// it changes. Sends do not block, c should be buffered.
+func NotifyState(c chan State) {
+	connMu.Lock()
+	defer connMu.Unlock()
+	listeners = append(listeners, c)
+}
+
+// setState must be called with connMu held
+func setState(s State) {
+	if s == state {
+		return
+	}
+	state = s
+	select {
+	case <-connected: // closed
+		if s == StateDisconnected {
+			connected = make(chan struct{})
+		}
+	default:
+		if s != StateDisconnected { // wake up the waiters
+			close(connected)
+		}
+	}
+	log.Print("rabbitmq connection ", s)
+	for _, c := range listeners {
+		select {
+		case c <- s:
+		default:
+		}
+	}
+}
+
+// waitConnected blocks till the connection is up, for at most timeout, or
+// forever if timeout is 0. Returns false if not connected, or closed.
+func waitConnected(timeout time.Duration) bool {
+	connMu.RLock()
+	c, s := connected, state
+	connMu.RUnlock()
+	switch s {
+	case StateConnected:
+		return true
+	case StateClosed:
+		return false
+	}
+	var expired <-chan time.Time
+	if timeout > 0 {
+		t := time.NewTimer(timeout)
+		defer t.Stop()
+		expired = t.C
+	}
+	select {
+	case <-c:
+		return ConnectionState() == StateConnected
+	case <-expired:
+		return false
+	}
+}
+
+// Takes connection url of the rabbitmq, and creates a connection.
+// The connection is re-established, along with the channels and the
+// topology declared with Setup, whenever it is lost.
+// If no queue implementation is registered, DialConn registers rmq, as
+// importing the package used to. The fallback is deprecated, and will be
+// removed, call Init, or use Configure with the backend package.
+func DialConn(conUrl string) (*amqp.Connection, error) {
+	c, err := dial(conUrl)
+	if err != nil {
+		return nil, err
+	}
+	if jobs.RegisteredDoer() == nil {
+		log.Print("rmq: no queue implementation registered, registering rmq, call rmq.Init as this fallback will be removed")
+		Init()
+	}
+	return c, nil
+}
+
+func dial(conUrl string) (*amqp.Connection, error) {
+	c, err := amqp.Dial(conUrl)
+	if err != nil {
+		return nil, err
+	}
+	connMu.Lock()
+	old := conn
+	conn, dialURL = c, conUrl
+	setState(StateConnected)
+	connMu.Unlock()
+	if old != nil {
+		closePublisher()
+		old.Close()
+	}
+	go watch(c)
+	return c, nil
+}
+
+// Initiates the publisher channel, and returns it
+// once Initiated, pubCh should not be tampered with
+func InitPubChannel() (*amqp.Channel, error) {
+	connMu.Lock()
+	defer connMu.Unlock()
+	if conn == nil {
+		return nil, ErrNotConnected
+	}
+	ch, err := conn.Channel()
+	if err != nil {
+		return nil, err
+	}
+	pubCh = ch
+	return pubCh, nil
+}
+
+// Inititates Consumer channel, and returns it.
+// Consumer channel returned here should not be tampered with.
+// this is used by the Monitor() method which must be ran as a goroutine
+func InitConsumerChannel() (*amqp.Channel, error) {
+	connMu.Lock()
+	defer connMu.Unlock()
+	if conn == nil {
+		return nil, ErrNotConnected
+	}
+	ch, err := conn.Channel()
+	if err != nil {
+		return nil, err
+	}
+	consumerCh = ch
+	return consumerCh, nil
+}
+
+// Close closes the connection, it is not re-established,
+// and the Monitors return
+func Close() error {
+	connMu.Lock()
+	c := conn
+	setState(StateClosed)
+	connMu.Unlock()
+	closePublisher()
+	if c == nil {
+		return nil
+	}
+	return c.Close()
+}
+
+// watch re-establishes the connection c once it is lost,
+// unless it was closed with Close, or replaced by DialConn
+func watch(c *amqp.Connection) {
+	err := <-c.NotifyClose(make(chan *amqp.Error, 1))
+	connMu.Lock()
+	if conn != c || state == StateClosed {
+		connMu.Unlock()
+		return
+	}
+	setState(StateDisconnected)
+	connMu.Unlock()
+	log.Print("rabbitmq connection lost: ", err)
+	closePublisher()
+	reconnect(c)
+}
+
+// reconnect keeps trying, with exponential backoff, till the connection,
+// the channels and the topology are re-established
+func reconnect(old *amqp.Connection) {
+	backoff := MinBackoff
+	for {
+		connMu.RLock()
+		url, replaced := dialURL, conn != old || state == StateClosed
+		connMu.RUnlock()
+		if replaced {
+			return
+		}
+		err := redial(old, url)
+		if err == nil {
+			return
+		}
+		log.Printf("error reconnecting to rabbitmq, retrying in %s: %v", backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
+		if backoff > MaxBackoff {
+			backoff = MaxBackoff
+		}
+	}
+}
+
+// redial replaces the connection old, and its channels, with new ones,
+// and declares the topology again
+func redial(old *amqp.Connection, url string) error {
+	c, err := amqp.Dial(url)
+	if err != nil {
+		return err
+	}
+	pch, err := c.Channel()
+	if err != nil {
+		c.Close()
+		return err
+	}
+	cch, err := c.Channel()
+	if err != nil {
+		c.Close()
+		return err
+	}
+	err = declareTopology(pch)
+	if err != nil {
+		c.Close()
+		return err
+	}
+	connMu.Lock()
+	if conn != old || state == StateClosed {
+		connMu.Unlock()
+		c.Close()
+		return nil
+	}
+	conn, pubCh, consumerCh = c, pch, cch
+	setState(StateConnected)
+	connMu.Unlock()
+	go watch(c)
+	return nil
+}
+
+// reopenConsumerChannel opens a new consumer channel, if ch is still the
+// consumer channel and the connection is up, i.e. if only the channel was closed
+func reopenConsumerChannel(ch *amqp.Channel) error {
+	connMu.Lock()
+	defer connMu.Unlock()
+	if ch != consumerCh || state != StateConnected {
+		return nil
+	}
+	c, err := conn.Channel()
+	if err != nil {
+		return err
+	}
+	consumerCh = c
+	return nil
+}
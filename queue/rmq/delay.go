@@ -0,0 +1,135 @@
+package rmq
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// DelayStrategy decides how the jobs are delayed till they are due
+type DelayStrategy int
+
+const (
+	// The exchanges are delayed message exchanges, which hold the jobs
+	// till they are due, the rabbitmq_delayed_message_exchange plugin
+	// must be enabled on the broker. The default.
+	DelayPlugin DelayStrategy = iota
+
+	// The exchanges are plain topic exchanges, and the delayed jobs are
+	// parked in delay bucket queues, of the delays in DelayBuckets, which
+	// dead-letter them back to the exchange once expired. A job is parked
+	// in the longest bucket not longer than its delay, and on being
+	// dead-lettered before it is due, the consumer parks it again for the
+	// rest of the delay, so jobs run at most DelayBuckets[0] late.
+	DelayTTL
+)
+
+// Delay is the delay strategy of the exchanges declared by Setup, and of
+// the jobs enqueued, it is set by Configure from the delay_strategy of the
+// configuration. Note that an existing exchange cannot be changed from one
+// strategy to the other, it must be deleted first, or be another exchange.
+var Delay = DelayPlugin
+
+// DelayBuckets are the delays of the bucket queues, with DelayTTL, in
+// increasing order, from 1 second to 2^16 seconds, by powers of two
+var DelayBuckets = powersOfTwo(time.Second, 17)
+
+func powersOfTwo(d time.Duration, n int) []time.Duration {
+	b := make([]time.Duration, n)
+	for i := range b {
+		b[i] = d << uint(i)
+	}
+	return b
+}
+
+func (s DelayStrategy) String() string {
+	switch s {
+	case DelayPlugin:
+		return "plugin"
+	case DelayTTL:
+		return "ttl"
+	}
+	return "unknown"
+}
+
+// ParseDelayStrategy parses the names returned by String, "" is DelayPlugin
+func ParseDelayStrategy(s string) (DelayStrategy, error) {
+	switch s {
+	case "", "plugin":
+		return DelayPlugin, nil
+	case "ttl":
+		return DelayTTL, nil
+	}
+	return DelayPlugin, fmt.Errorf("unknown delay strategy %q", s)
+}
+
+// Returned by SetDelayBuckets for no buckets, or a bucket shorter than
+// a millisecond, whose jobs would expire right away, again and again
+var ErrDelayBuckets = errors.New("at least one delay bucket, of a millisecond or more, is required")
+
+// SetDelayBuckets sets DelayBuckets, in increasing order, it must
+// be called before Setup, the buckets are declared with the exchanges
+func SetDelayBuckets(buckets []time.Duration) error {
+	if len(buckets) == 0 {
+		return ErrDelayBuckets
+	}
+	for _, v := range buckets {
+		if v < time.Millisecond {
+			return ErrDelayBuckets
+		}
+	}
+	b := append([]time.Duration{}, buckets...)
+	sort.Slice(b, func(i, k int) bool { return b[i] < b[k] })
+	DelayBuckets = b
+	return nil
+}
+
+// bucketName is the name of both the queue, and the fanout
+// exchange the jobs are published to, of a delay bucket
+func bucketName(exchangeName string, d time.Duration) string {
+	return fmt.Sprintf("%s.delay.%d", exchangeName, d/time.Millisecond)
+}
+
+// bucket returns the delay bucket the job with the delay is parked in,
+// the shortest one if the delay is shorter than every bucket
+func bucket(delay time.Duration) time.Duration {
+	b := DelayBuckets[0]
+	for _, v := range DelayBuckets {
+		if v <= delay {
+			b = v
+		}
+	}
+	return b
+}
+
+// declareBuckets declares the delay buckets of the exchange, the jobs
+// are published to the fanout exchange of a bucket, with their routing
+// key, which is kept when they are dead-lettered back to the exchange
+func declareBuckets(ch *amqp.Channel, exchangeName string) error {
+	for _, d := range DelayBuckets {
+		name := bucketName(exchangeName, d)
+		err := ch.ExchangeDeclare(name, "fanout", true, false, false, false, nil)
+		if err != nil {
+			log.Print("Error creating delay bucket exchange ", err)
+			return err
+		}
+		_, err = ch.QueueDeclare(name, true, false, false, false, amqp.Table{
+			"x-message-ttl":          int64(d / time.Millisecond),
+			"x-dead-letter-exchange": exchangeName,
+		})
+		if err != nil {
+			log.Print("Error creating delay bucket queue ", err)
+			return err
+		}
+		err = ch.QueueBind(name, "", name, false, nil)
+		if err != nil {
+			log.Print("Error binding delay bucket queue ", err)
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,21 @@
+package rmq
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSetDelayBuckets(t *testing.T) {
+	defer func(b []time.Duration) { DelayBuckets = b }(DelayBuckets)
+	for _, b := range [][]time.Duration{nil, {}, {time.Second, 0}, {-time.Second}, {time.Microsecond}} {
+		if err := SetDelayBuckets(b); err != ErrDelayBuckets {
+			t.Errorf("%v: got %v, want ErrDelayBuckets", b, err)
+		}
+	}
+	if err := SetDelayBuckets([]time.Duration{time.Minute, time.Second}); err != nil {
+		t.Fatal(err)
+	}
+	if bucket(time.Millisecond) != time.Second || bucket(time.Hour) != time.Minute || bucket(30*time.Second) != time.Second {
+		t.Errorf("wrong buckets for %v", DelayBuckets)
+	}
+}
@@ -0,0 +1,87 @@
+package rmq
+
+import "sync"
+
+// PoolSize is the maximum number of channels used for publishing
+// concurrently, it must be set before the first job is enqueued
+var PoolSize = 8
+
+// pool of publishers, each on a channel of its own, so that concurrent
+// Enqueue calls neither share a channel nor wait on a single one
+type pool struct {
+	once  sync.Once
+	slots chan struct{}
+
+	mu   sync.Mutex
+	idle []*publisher
+
+	// incremented on reset, publishers of an older
+	// generation are closed when returned
+	gen int
+}
+
+type pooledPublisher struct {
+	*publisher
+	gen int
+}
+
+var publishers = &pool{}
+
+// get checks out an idle publisher, or opens a new one, waiting
+// while PoolSize publishers are checked out
+func (p *pool) get() (*pooledPublisher, error) {
+	p.once.Do(func() {
+		size := PoolSize
+		if size < 1 {
+			size = 1
+		}
+		p.slots = make(chan struct{}, size)
+	})
+	p.slots <- struct{}{}
+
+	p.mu.Lock()
+	gen := p.gen
+	if n := len(p.idle); n > 0 {
+		pub := p.idle[n-1]
+		p.idle = p.idle[:n-1]
+		p.mu.Unlock()
+		return &pooledPublisher{pub, gen}, nil
+	}
+	p.mu.Unlock()
+
+	c := GetAMQPConn()
+	if c == nil || ConnectionState() != StateConnected {
+		<-p.slots
+		return nil, ErrNotConnected
+	}
+	pub, err := newPublisher(c)
+	if err != nil {
+		<-p.slots
+		return nil, err
+	}
+	return &pooledPublisher{pub, gen}, nil
+}
+
+// put returns the publisher to the pool, it is closed
+// instead if broken, or opened before the last reset
+func (p *pool) put(pub *pooledPublisher, broken bool) {
+	defer func() { <-p.slots }()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if broken || pub.gen != p.gen {
+		pub.close()
+		return
+	}
+	p.idle = append(p.idle, pub.publisher)
+}
+
+// reset closes the idle publishers, i.e. when the connection is lost
+func (p *pool) reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.gen++
+	for _, pub := range p.idle {
+		pub.close()
+	}
+	p.idle = nil
+}
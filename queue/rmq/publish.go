@@ -0,0 +1,203 @@
+package rmq
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+var (
+	// Returned by Enqueue when the broker did not accept the job
+	ErrNacked = errors.New("job not accepted by the broker")
+
+	// Returned by Enqueue when no queue is bound for the routing key of the job
+	ErrUnroutable = errors.New("job not routed to any queue")
+
+	// Returned by Enqueue when the broker did not confirm the job in time,
+	// the job may, or may not, have been accepted
+	ErrConfirmTimeout = errors.New("timed out waiting for the broker to confirm the job")
+)
+
+// ConfirmTimeout is how long Enqueue waits for the broker to confirm a job
+var ConfirmTimeout = 5 * time.Second
+
+// Mandatory makes Enqueue return ErrUnroutable for the jobs not routed to
+// any queue. The delayed message exchange routes the jobs only once their
+// delay passes, hence only the jobs without a delay are published with the
+// mandatory flag to it. With DelayTTL, the delayed jobs are published with
+// it to their delay bucket, and are never reported as unroutable either.
+var Mandatory = true
+
+// pubChannel is the part of *amqp.Channel a publisher uses
+type pubChannel interface {
+	Publish(exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error
+	Close() error
+}
+
+// publisher publishes on a channel in confirm mode, one message at
+// a time, and waits for its confirmation. It is not safe for concurrent
+// use, publishers are checked out of the pool by one goroutine at a time.
+type publisher struct {
+	ch       pubChannel
+	seq      uint64
+	confirms chan amqp.Confirmation
+	returns  chan amqp.Return
+
+	// receives the exception the channel is closed with, if any
+	closed chan *amqp.Error
+}
+
+func newPublisher(c *amqp.Connection) (*publisher, error) {
+	ch, err := c.Channel()
+	if err != nil {
+		return nil, err
+	}
+	err = ch.Confirm(false)
+	if err != nil {
+		ch.Close()
+		return nil, err
+	}
+	return &publisher{
+		ch:       ch,
+		confirms: ch.NotifyPublish(make(chan amqp.Confirmation, 16)),
+		returns:  ch.NotifyReturn(make(chan amqp.Return, 16)),
+		closed:   ch.NotifyClose(make(chan *amqp.Error, 1)),
+	}, nil
+}
+
+// publish returns ErrNacked, ErrUnroutable or ErrConfirmTimeout, wrapped,
+// or the *amqp.Error the channel was closed with, i.e. a 404 for an
+// exchange which is not declared. msg.MessageId must be set, it identifies
+// the message if returned.
+func (p *publisher) publish(exchange, key string, mandatory bool, msg amqp.Publishing) error {
+	err := p.ch.Publish(exchange, key, mandatory, false, msg)
+	if err != nil {
+		return p.closeError(err)
+	}
+	p.seq++
+	timer := time.NewTimer(ConfirmTimeout)
+	defer timer.Stop()
+	var returned *amqp.Return
+	for {
+		select {
+		case e := <-p.closed:
+			if e == nil {
+				return amqp.ErrClosed
+			}
+			return e
+		case r, ok := <-p.returns:
+			if !ok {
+				return p.closeError(amqp.ErrClosed)
+			}
+			if r.MessageId == msg.MessageId { // else left over from a timed out publish
+				returned = &r
+			}
+		case c, ok := <-p.confirms:
+			if !ok {
+				return p.closeError(amqp.ErrClosed)
+			}
+			if c.DeliveryTag < p.seq { // left over from a timed out publish
+				continue
+			}
+			if !c.Ack {
+				return ErrNacked
+			}
+			// a return is always sent before the ack of the message
+			if returned == nil {
+				returned = p.returned(msg.MessageId)
+			}
+			if returned != nil {
+				return fmt.Errorf("%w, exchange: %s, routing key: %s: %s", ErrUnroutable, exchange, key, returned.ReplyText)
+			}
+			return nil
+		case <-timer.C:
+			return ErrConfirmTimeout
+		}
+	}
+}
+
+// returned looks for the return of the message, among those already received
+func (p *publisher) returned(id string) *amqp.Return {
+	for {
+		select {
+		case r, ok := <-p.returns:
+			if !ok {
+				return nil
+			}
+			if r.MessageId == id {
+				return &r
+			}
+		default:
+			return nil
+		}
+	}
+}
+
+// closeError returns the exception the channel was closed with, if any,
+// which is sent before the notification channels are closed, or err
+func (p *publisher) closeError(err error) error {
+	select {
+	case e := <-p.closed:
+		if e != nil {
+			return e
+		}
+	default:
+	}
+	return err
+}
+
+func (p *publisher) close() {
+	p.ch.Close()
+}
+
+// publish publishes with a publisher from the pool. The message is
+// published again, on a new channel, if the channel or the connection
+// was lost, not if the broker closed the channel with an exception, as
+// publishing again would fail the same way, nor if the broker did not
+// confirm the message in time, as it may have been accepted.
+func publish(exchange, key string, mandatory bool, msg amqp.Publishing) error {
+	err := publishOnce(exchange, key, mandatory, msg)
+	if !isConnectionError(err) {
+		return err
+	}
+	return publishOnce(exchange, key, mandatory, msg)
+}
+
+func publishOnce(exchange, key string, mandatory bool, msg amqp.Publishing) error {
+	p, err := publishers.get()
+	if err != nil {
+		return err
+	}
+	err = p.publish(exchange, key, mandatory, msg)
+	// the confirmations of a timed out channel may be out of order
+	publishers.put(p, isChannelError(err) || err == ErrConfirmTimeout)
+	return err
+}
+
+// closePublisher closes the idle publishers, the ones checked out are
+// closed when returned, new ones are opened on publishing next
+func closePublisher() {
+	publishers.reset()
+}
+
+// isChannelError is true if the channel can't be used anymore
+func isChannelError(err error) bool {
+	var aerr *amqp.Error
+	return errors.As(err, &aerr) || err == ErrNotConnected
+}
+
+// isChannelException is true for the soft errors the broker closes a
+// channel with, i.e. 404 for an exchange which is not declared, the
+// connection is fine, and retrying fails the same way
+func isChannelException(err error) bool {
+	var aerr *amqp.Error
+	return errors.As(err, &aerr) && aerr.Server && aerr.Recover
+}
+
+// isConnectionError is true if the channel, or the connection, was lost,
+// retrying on a new channel, once connected, may succeed
+func isConnectionError(err error) bool {
+	return isChannelError(err) && !isChannelException(err)
+}
@@ -0,0 +1,100 @@
+package rmq
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// fakeChannel runs onPublish for every message published
+type fakeChannel struct {
+	onPublish func(msg amqp.Publishing) error
+}
+
+func (c *fakeChannel) Publish(exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error {
+	return c.onPublish(msg)
+}
+
+func (c *fakeChannel) Close() error { return nil }
+
+func newFakePublisher(onPublish func(p *publisher, msg amqp.Publishing) error) *publisher {
+	p := &publisher{
+		confirms: make(chan amqp.Confirmation, 16),
+		returns:  make(chan amqp.Return, 16),
+		closed:   make(chan *amqp.Error, 1),
+	}
+	p.ch = &fakeChannel{onPublish: func(msg amqp.Publishing) error { return onPublish(p, msg) }}
+	return p
+}
+
+func TestPublishConfirm(t *testing.T) {
+	defer func(d time.Duration) { ConfirmTimeout = d }(ConfirmTimeout)
+	ConfirmTimeout = 50 * time.Millisecond
+	notFound := &amqp.Error{Code: 404, Reason: "NOT_FOUND - no exchange 'reports'", Server: true, Recover: true}
+	cases := []struct {
+		name    string
+		publish func(p *publisher, msg amqp.Publishing) error
+		want    error
+	}{
+		{"ack", func(p *publisher, msg amqp.Publishing) error {
+			p.confirms <- amqp.Confirmation{DeliveryTag: p.seq + 1, Ack: true}
+			return nil
+		}, nil},
+		{"nack", func(p *publisher, msg amqp.Publishing) error {
+			p.confirms <- amqp.Confirmation{DeliveryTag: p.seq + 1}
+			return nil
+		}, ErrNacked},
+		{"returned", func(p *publisher, msg amqp.Publishing) error {
+			p.returns <- amqp.Return{MessageId: msg.MessageId, ReplyText: "NO_ROUTE"}
+			p.confirms <- amqp.Confirmation{DeliveryTag: p.seq + 1, Ack: true}
+			return nil
+		}, ErrUnroutable},
+		{"leftovers", func(p *publisher, msg amqp.Publishing) error {
+			p.returns <- amqp.Return{MessageId: "other"}
+			p.confirms <- amqp.Confirmation{DeliveryTag: p.seq}
+			p.confirms <- amqp.Confirmation{DeliveryTag: p.seq + 1, Ack: true}
+			return nil
+		}, nil},
+		{"timeout", func(p *publisher, msg amqp.Publishing) error {
+			return nil
+		}, ErrConfirmTimeout},
+		{"channel exception", func(p *publisher, msg amqp.Publishing) error {
+			p.closed <- notFound
+			close(p.confirms)
+			return nil
+		}, notFound},
+		{"closed", func(p *publisher, msg amqp.Publishing) error {
+			p.closed <- notFound
+			return amqp.ErrClosed
+		}, notFound},
+	}
+	for _, c := range cases {
+		p := newFakePublisher(c.publish)
+		p.seq = 3
+		err := p.publish("jobs", "key", true, amqp.Publishing{MessageId: "1"})
+		if !errors.Is(err, c.want) {
+			t.Errorf("%s: got %v, want %v", c.name, err, c.want)
+		}
+	}
+}
+
+func TestConnectionError(t *testing.T) {
+	cases := []struct {
+		err  error
+		want bool
+	}{
+		{amqp.ErrClosed, true},
+		{ErrNotConnected, true},
+		{&amqp.Error{Code: 320, Reason: "CONNECTION_FORCED", Server: true}, true},
+		{&amqp.Error{Code: 404, Reason: "NOT_FOUND", Server: true, Recover: true}, false},
+		{ErrNacked, false},
+		{ErrConfirmTimeout, false},
+	}
+	for _, c := range cases {
+		if got := isConnectionError(c.err); got != c.want {
+			t.Errorf("%v: got %t, want %t", c.err, got, c.want)
+		}
+	}
+}
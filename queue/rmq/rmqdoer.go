@@ -1,66 +1,189 @@
 package rmq
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
-	"os"
+	"time"
 
+	"github.com/betacraft/scheduler/config"
 	"github.com/betacraft/scheduler/jobs"
-	"github.com/go-ini/ini"
 	"github.com/streadway/amqp"
 )
 
-func init() {
-	d := new(rmqdoer)
-	jobs.RegisterDoer(d)
+// Init registers the rmq implementation with the jobs package,
+// on the connection made with DialConn, or Configure
+func Init() {
+	jobs.RegisterDoer(new(rmqdoer))
+	log.Print("registering job scheduler with rmq")
+}
+
+// New connects with Configure, and returns the rmq implementation,
+// without registering it, check the backend package
+func New(c config.RMQ) (jobs.Doer, error) {
+	err := Configure(c)
+	if err != nil {
+		return nil, err
+	}
+	return new(rmqdoer), nil
 }
 
 type rmqdoer struct {
 }
 
+// Validate checks for a routing key, of the job or of the route set
+// for its type, the queues are bound to the exchanges with one
+func (d *rmqdoer) Validate(j *jobs.Job) error {
+	_, key := route(j)
+	if key == "" {
+		return &jobs.ValidationError{Field: "RoutingKey", Err: jobs.ErrMissingField}
+	}
+	return nil
+}
+
 func (d *rmqdoer) Enqueue(j *jobs.Job) error {
+	return enqueue(j, jobs.Now().Add(j.Delay()))
+}
+
+// dueHeader carries the time a job is due, in milliseconds since the
+// epoch, with DelayTTL, the consumer parks the jobs not due yet again
+const dueHeader = "x-due"
+
+// enqueue publishes the job to be delivered once due
+func enqueue(j *jobs.Job, due time.Time) error {
 	res, err := json.Marshal(j)
 	if err != nil {
 		log.Print("Error marshaling job", err)
 		return err
 	}
+	delay := int64(due.Sub(jobs.Now()) / time.Millisecond)
+	if delay < 0 {
+		delay = 0
+	}
 	headers := amqp.Table{}
-	headers["x-delay"] = j.Interval
+	headers["x-delay"] = delay
+	if Delay == DelayTTL {
+		headers[dueHeader] = due.UnixNano() / int64(time.Millisecond)
+	}
+	id, err := newMessageID(j)
+	if err != nil {
+		return err
+	}
 	pub := amqp.Publishing{
 		DeliveryMode: amqp.Persistent,
 		ContentType:  "text/json",
+		MessageId:    id,
 		Body:         res,
 		Headers:      headers,
 	}
-	err = pubCh.Publish("droidcloud", j.RoutingKey, false, false, pub)
+	ex, key := route(j)
+	mandatory := Mandatory && delay == 0
+	if Delay == DelayTTL && delay > 0 {
+		// parked in a delay bucket, which is bound, unlike the queues
+		// bound to the exchange the job is routed to once it is due
+		ex = bucketName(ex, bucket(time.Duration(delay)*time.Millisecond))
+		mandatory = Mandatory
+	}
+	err = publish(ex, key, mandatory, pub)
+	if isConnectionError(err) && waitConnected(ConfirmTimeout) { // the connection was down
+		err = publishOnce(ex, key, mandatory, pub)
+	}
 	if err != nil {
-		pubCh.Close()
-		pubCh, err = conn.Channel()
-		if err != nil { // recreate channel
-			conn.Close()
-			restartConn()
-			pubCh, err = conn.Channel()
-		}
-		err = pubCh.Publish("droidcloud", j.RoutingKey, false, false, pub)
+		log.Printf("error enqueueing JobID: %s, JobType: %s: %v", j.ID, j.Type, err)
+		return err
 	}
-	log.Print(fmt.Sprintf("Enqueued JobID: %s, JobType: %s, delay: %d", j.ID, j.Type, j.Interval))
+	log.Print(fmt.Sprintf("Enqueued JobID: %s, JobType: %s, delay: %d, exchange: %s, routing key: %s", j.ID, j.Type, delay, ex, key))
 	return err
 }
 
+// Monitor consumes from the queue till the connection is closed with
+// Close. Consumption stops while the queue is paused, or the connection
+// is down, and resumes once the queue is resumed, or reconnected.
 func (d *rmqdoer) Monitor(c jobs.Config) {
+	addQueue(c.QueueName)
+	backoff := MinBackoff
 	for {
-		consume(c.QueueName)
-		restartConn()
-		restartPubChannel()
-		restartConsumerChannel()
+		if !waitConnected(0) {
+			log.Print("connection closed, stopping consumer for ", c.QueueName)
+			return
+		}
+		jobs.WaitWhilePaused(c.QueueName)
+		ch := GetConsumerChannel()
+		start := time.Now()
+		paused := consume(ch, c.QueueName)
+		if paused { // consumer was cancelled, connection is fine
+			continue
+		}
+		// the channel, or the connection, was closed. The connection is
+		// re-established by the connection manager, only the channel is
+		// reopened here
+		err := reopenConsumerChannel(ch)
+		if err != nil {
+			log.Print("error re-initiating consumer channel: ", err)
+		}
+		if time.Since(start) > MaxBackoff {
+			backoff = MinBackoff
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+		if backoff > MaxBackoff {
+			backoff = MaxBackoff
+		}
 	}
 }
 
-func consume(qname string) {
+// newMessageID identifies the publishing of the job, for matching
+// the returned messages
+func newMessageID(j *jobs.Job) (string, error) {
+	id, err := randomID()
+	if err != nil {
+		return "", err
+	}
+	return j.ID + "-" + id, nil
+}
+
+func randomID() (string, error) {
+	b := make([]byte, 8)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Queues lists the queues created with Setup, or being monitored,
+// along with the number of messages ready in them
+func (d *rmqdoer) Queues() ([]jobs.QueueInfo, error) {
+	list := []jobs.QueueInfo{}
+	for _, name := range queueNames() {
+		n, err := QueueLength(name)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, jobs.QueueInfo{Name: name, Messages: int64(n)})
+	}
+	return list, nil
+}
+
+// consume returns true, if it returned because the queue was paused,
+// and false once the channel is closed
+func consume(ch *amqp.Channel, qname string) bool {
+	if ch == nil {
+		return false
+	}
 	log.Print("starting consumer for ", qname)
 	consName := fmt.Sprintf("%s-consumer", qname)
-	msgs, err := consumerCh.Consume(
+	// the deliveries are acked once their job has run, without a limit
+	// the broker would push the whole queue to the consumer
+	err := ch.Qos(Prefetch, 0, false)
+	if err != nil {
+		log.Print("error setting the prefetch count: ", err)
+		return false
+	}
+	msgs, err := ch.Consume(
 		qname,    // queue
 		consName, // consumer
 		false,    // auto-ack
@@ -72,60 +195,66 @@ func consume(qname string) {
 
 	if err != nil {
 		log.Print("queue consumer could not be initiated:", err)
-		return
+		return false
 	}
 
-	done := make(chan bool)
+	// closed with the channel, the unacked deliveries are then redelivered
+	closed := ch.NotifyClose(make(chan *amqp.Error, 1))
+
+	stop := make(chan bool)
+	defer close(stop)
+	go cancelOnPause(ch, qname, consName, stop)
+
+	done := make(chan bool, 1)
 	go func() {
 		for {
 			// Check if channel is up
-			d := <-msgs
+			d, ok := <-msgs
+			if !ok { // consumer cancelled, or channel closed
+				notify(done)
+				return
+			}
+			if jobs.QueuePaused(qname) { // delivered before the consumer was cancelled
+				d.Nack(false, true)
+				continue
+			}
 			log.Print("received message to execute")
-			defer rescue()               // recover in case of panicks, and wait for other messages
-			go func(del amqp.Delivery) { // start a goroutine to handle a message delivery
-				j := &jobs.Job{}
-				err := json.Unmarshal(del.Body, &j)
-
-				// Ack message always
-				defer func(d amqp.Delivery) {
-					log.Print(fmt.Sprintf("Ack delivery, JobID: %s, JobType: %s, consumer: %s", j.ID, j.Type, d.ConsumerTag))
-					d.Ack(false)
-				}(del)
-
-				// Do nothing if unmarshalling fails
-				if err != nil {
-					log.Print("Error converting message body to job: ", err)
-					return
-				}
-
-				// panic point if GetExecutor returns nil
-				err = j.GetExecutor().Execute(j)
-				if err != nil { // do not enqueue if execute returns error
-					log.Print("error executing job: ", err)
-					return
-				}
-
-				log.Print("succesfully executed job")
-				if j.IsRecurring {
-					log.Print(fmt.Sprintf("re-enqueing, JobID: %s, JobType: %s", j.ID, j.Type))
-					err = jobs.Enqueue(j)
-					if err == nil { // succesfully enqueued
-						return
-					}
-
-					// failure enqueueing
-					switch err.(type) {
-					case amqp.Error:
-						err, _ = err.(amqp.Error)
-						done <- true
-					default:
-						log.Print("marshal error do nothing")
-					}
-				}
-			}(d)
+			go handle(d, closed) // start a goroutine to handle a message delivery
 		}
 	}()
 	<-done
+	return jobs.QueuePaused(qname)
+}
+
+// notify does not block if done has already been notified
+func notify(done chan bool) {
+	select {
+	case done <- true:
+	default:
+	}
+}
+
+// cancelOnPause cancels the consumer once the queue is paused,
+// which closes its delivery channel
+func cancelOnPause(ch *amqp.Channel, qname, consName string, stop chan bool) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if !jobs.QueuePaused(qname) {
+				continue
+			}
+			log.Print("queue paused, cancelling consumer ", consName)
+			err := ch.Cancel(consName, false)
+			if err != nil {
+				log.Print("error cancelling consumer: ", err)
+			}
+			return
+		}
+	}
 }
 
 func rescue() {
@@ -134,37 +263,119 @@ func rescue() {
 	}
 }
 
-func restartConn() {
-	cfg, _ := ini.Load("config.ini")
-	config, _ := cfg.GetSection(os.Getenv("ENV"))
-	var err error
-	conn.Close()
-	conn, err = DialConn(config.Key("rabbitmq_dial_url").String())
-	if err != nil {
-		log.Print("error re-initiating connection: ", err)
-		panic(err)
+// dueTime returns the time the job of the delivery is due, from
+// dueHeader, or its ExecTime for the jobs published without it
+func dueTime(d amqp.Delivery, j *jobs.Job) time.Time {
+	if ms, ok := d.Headers[dueHeader].(int64); ok {
+		return time.Unix(0, ms*int64(time.Millisecond))
 	}
-	log.Print("re-initiated connection")
+	return j.ExecTime
 }
 
-func restartPubChannel() {
-	pubCh.Close()
-	var err error
-	pubCh, err = conn.Channel()
+// ErrDeliveryLost is returned by the heartbeats of a job whose consumer
+// channel has closed, the job is delivered again, to this or another consumer
+var ErrDeliveryLost = errors.New("consumer channel closed, the job will be redelivered")
+
+// handle executes the job of a delivery, and settles the delivery,
+// as decided by Ack, once the executor has returned. The heartbeats of
+// the job fail once closed is, the delivery can't be settled anymore.
+func handle(d amqp.Delivery, closed <-chan *amqp.Error) {
+	defer rescue() // recover in case of panicks, and wait for other messages
+	j := &jobs.Job{}
+	err := json.Unmarshal(d.Body, &j)
+
+	// Dead-letter if unmarshalling fails
 	if err != nil {
-		log.Print("error re-initiating publisher channel: ", err)
-		panic(err)
+		log.Print("Error converting message body to job: ", err)
+		d.Nack(false, false)
+		return
 	}
-	log.Print("re-initiated publisher channel")
-}
 
-func restartConsumerChannel() {
-	consumerCh.Close()
-	var err error
-	consumerCh, err = conn.Channel()
+	if due := dueTime(d, j); Delay == DelayTTL && due.After(jobs.Now()) {
+		// dead-lettered by a delay bucket shorter than the delay, parked again
+		err = enqueue(j, due)
+		if isConnectionError(err) || err == ErrConfirmTimeout {
+			log.Printf("error parking JobID: %s, JobType: %s: %v", j.ID, j.Type, err)
+			d.Nack(false, true)
+			return
+		}
+		if err != nil {
+			log.Printf("error parking, dead-lettering JobID: %s, JobType: %s: %v", j.ID, j.Type, err)
+			d.Nack(false, false)
+			return
+		}
+		d.Ack(false)
+		return
+	}
+
+	j.SetHeartbeatFunc(func() error {
+		select {
+		case <-closed:
+			return ErrDeliveryLost
+		default:
+			return nil
+		}
+	})
+	action, err := jobs.Process(j)
 	if err != nil {
-		log.Print("error re-initiating consumer channel: ", err)
-		panic(err)
+		log.Print("error executing job: ", err)
+	} else {
+		log.Print("succesfully executed job")
+	}
+	if action == jobs.ActionDeadLetter {
+		// routed to the dead letter queue of the queue, if set in Setup
+		log.Print(fmt.Sprintf("dead-lettering, JobID: %s, JobType: %s", j.ID, j.Type))
+		if d.Nack(false, false) == nil {
+			jobs.Settled(j, action, err)
+		}
+		return
+	}
+	// the jobs to be retried or rescheduled are enqueued again whatever
+	// the mode, Process has already moved them to their next run
+	if err != nil && action == jobs.ActionDone {
+		switch Ack {
+		case AckOnSuccessRequeue:
+			// the job as redelivered does not keep its attempts, hence it is
+			// requeued only once, not to run it again and again right away
+			if !d.Redelivered {
+				log.Print(fmt.Sprintf("Nack delivery with requeue, JobID: %s, JobType: %s, consumer: %s", j.ID, j.Type, d.ConsumerTag))
+				d.Nack(false, true)
+				return
+			}
+			log.Print(fmt.Sprintf("Nack redelivered delivery, JobID: %s, JobType: %s, consumer: %s", j.ID, j.Type, d.ConsumerTag))
+			if d.Nack(false, false) == nil {
+				jobs.Settled(j, jobs.ActionDeadLetter, err)
+			}
+			return
+		case AckOnSuccessDeadLetter:
+			log.Print(fmt.Sprintf("Nack delivery, JobID: %s, JobType: %s, consumer: %s", j.ID, j.Type, d.ConsumerTag))
+			if d.Nack(false, false) == nil {
+				jobs.Settled(j, jobs.ActionDeadLetter, err)
+			}
+			return
+		}
+	}
+	switch action {
+	case jobs.ActionRetry, jobs.ActionReschedule, jobs.ActionHold:
+		log.Print(fmt.Sprintf("re-enqueing to %s, JobID: %s, JobType: %s, attempts: %d", action, j.ID, j.Type, j.Attempts))
+		eerr := jobs.Enqueue(j)
+		if isConnectionError(eerr) || eerr == ErrConfirmTimeout {
+			// requeued as it was delivered, not to lose the job, it may
+			// run twice if the unconfirmed job was published after all
+			log.Printf("error re-enqueueing JobID: %s, JobType: %s: %v", j.ID, j.Type, eerr)
+			d.Nack(false, true)
+			return
+		}
+		if eerr != nil {
+			// enqueueing again would fail the same way, i.e. ErrUnroutable
+			log.Printf("error re-enqueueing, dead-lettering JobID: %s, JobType: %s: %v", j.ID, j.Type, eerr)
+			if d.Nack(false, false) == nil {
+				jobs.Settled(j, jobs.ActionDeadLetter, eerr)
+			}
+			return
+		}
+		jobs.Settled(j, action, err)
 	}
-	log.Print("re-initiated consumer channel")
+	log.Print(fmt.Sprintf("Ack delivery, JobID: %s, JobType: %s, consumer: %s", j.ID, j.Type, d.ConsumerTag))
+	d.Ack(false)
 }
@@ -0,0 +1,185 @@
+package rmq
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/betacraft/scheduler/jobs"
+	"github.com/betacraft/scheduler/lock"
+	"github.com/betacraft/scheduler/store"
+	"github.com/streadway/amqp"
+)
+
+// acknowledger records how the delivery was settled
+type acknowledger struct {
+	settled string
+}
+
+func (a *acknowledger) Ack(tag uint64, multiple bool) error {
+	a.settled = "ack"
+	return nil
+}
+
+func (a *acknowledger) Nack(tag uint64, multiple, requeue bool) error {
+	a.settled = "dead-letter"
+	if requeue {
+		a.settled = "requeue"
+	}
+	return nil
+}
+
+func (a *acknowledger) Reject(tag uint64, requeue bool) error {
+	return a.Nack(tag, false, requeue)
+}
+
+type funcExecutor struct {
+	err error
+}
+
+func (e *funcExecutor) New() jobs.Executor        { return e }
+func (e *funcExecutor) Execute(j *jobs.Job) error { return e.err }
+
+// enqueueDoer returns err from Enqueue
+type enqueueDoer struct {
+	err error
+}
+
+func (d *enqueueDoer) Enqueue(j *jobs.Job) error { return d.err }
+func (d *enqueueDoer) Monitor(c jobs.Config)     {}
+
+func deliver(jobType string, redelivered bool) string {
+	a := &acknowledger{}
+	body := []byte(`{"id":"1","type":"` + jobType + `","queue":"q","interval":1000,"is_recurring":true}`)
+	handle(amqp.Delivery{Acknowledger: a, Body: body, Redelivered: redelivered}, make(chan *amqp.Error))
+	return a.settled
+}
+
+func TestHandleRequeueOnce(t *testing.T) {
+	defer func(m AckMode) { Ack = m }(Ack)
+	Ack = AckOnSuccessRequeue
+	// failed, and not enqueued again
+	jobs.RegisterExecutor("TestRequeue", &funcExecutor{err: jobs.StopRecurrence(errors.New("failed"))})
+	if got := deliver("TestRequeue", false); got != "requeue" {
+		t.Errorf("got %s, want requeue", got)
+	}
+	if got := deliver("TestRequeue", true); got != "dead-letter" {
+		t.Errorf("got %s for the redelivered job, want dead-letter", got)
+	}
+}
+
+func TestHandleEnqueueError(t *testing.T) {
+	defer jobs.RegisterDoer(jobs.RegisteredDoer())
+	jobs.RegisterExecutor("TestReenqueue", &funcExecutor{})
+	cases := []struct {
+		err  error
+		want string
+	}{
+		{nil, "ack"},
+		{amqp.ErrClosed, "requeue"},
+		{ErrNotConnected, "requeue"},
+		{ErrUnroutable, "dead-letter"},
+		{ErrNacked, "dead-letter"},
+		{&amqp.Error{Code: 404, Server: true, Recover: true}, "dead-letter"},
+		{ErrConfirmTimeout, "requeue"},
+	}
+	for _, c := range cases {
+		jobs.RegisterDoer(&enqueueDoer{err: c.err})
+		if got := deliver("TestReenqueue", false); got != c.want {
+			t.Errorf("%v: got %s, want %s", c.err, got, c.want)
+		}
+	}
+}
+
+func TestHandleAckModeSingleton(t *testing.T) {
+	defer func(m AckMode) { Ack = m }(Ack)
+	defer jobs.RegisterDoer(jobs.RegisteredDoer())
+	defer jobs.RegisterLocker(nil)
+	s := store.NewMemoryStore()
+	jobs.RegisterStore(s)
+	defer jobs.RegisterStore(nil)
+	Ack = AckOnSuccessDeadLetter
+	jobs.RegisterLocker(lock.NewMemoryLocker())
+	jobs.RegisterSingleton("TestAckSingleton", time.Minute)
+	jobs.RegisterExecutor("TestAckSingleton", &funcExecutor{err: jobs.RetryAfter(errors.New("failed"), time.Minute)})
+	other := &jobs.Job{ID: "2", Type: "TestAckSingleton", Queue: "q", Interval: 1000}
+
+	jobs.RegisterDoer(&enqueueDoer{})
+	if err := jobs.Enqueue(&jobs.Job{ID: "1", Type: "TestAckSingleton", Queue: "q", Interval: 1000}); err != nil {
+		t.Fatal(err)
+	}
+	// retried whatever the mode, keeping the schedule lock
+	if got := deliver("TestAckSingleton", false); got != "ack" {
+		t.Errorf("got %s for a job retried, want ack", got)
+	}
+	if err := jobs.Enqueue(other); err != jobs.ErrAlreadyScheduled {
+		t.Errorf("got %v, want the lock kept by the retried job", err)
+	}
+
+	// the retried copy, dead-lettered as it can't be enqueued again, releasing the lock
+	jobs.RegisterDoer(&enqueueDoer{err: ErrUnroutable})
+	r, _ := s.Get("1")
+	body, _ := json.Marshal(r.Job)
+	a := &acknowledger{}
+	handle(amqp.Delivery{Acknowledger: a, Body: body}, make(chan *amqp.Error))
+	if a.settled != "dead-letter" {
+		t.Errorf("got %s, want dead-letter", a.settled)
+	}
+	if r, _ = s.Get("1"); r.Status != jobs.StatusDead {
+		t.Errorf("got %s, want the job dead", r.Status)
+	}
+	jobs.RegisterDoer(&enqueueDoer{})
+	if err := jobs.Enqueue(other); err != nil {
+		t.Errorf("got %v, want the lock released", err)
+	}
+}
+
+func TestEnqueueKeepsJob(t *testing.T) {
+	defer func(s DelayStrategy, d time.Duration) { Delay, ConfirmTimeout = s, d }(Delay, ConfirmTimeout)
+	Delay, ConfirmTimeout = DelayTTL, 10*time.Millisecond
+	j := &jobs.Job{ID: "1", Type: "TestKeep", Interval: 1000}
+	if err := new(rmqdoer).Enqueue(j); err != ErrNotConnected {
+		t.Fatalf("got %v, want ErrNotConnected", err)
+	}
+	if !j.ExecTime.IsZero() {
+		t.Errorf("exec time of the caller's job set to %v", j.ExecTime)
+	}
+}
+
+func TestHandleParked(t *testing.T) {
+	defer func(s DelayStrategy, d time.Duration) { Delay, ConfirmTimeout = s, d }(Delay, ConfirmTimeout)
+	Delay, ConfirmTimeout = DelayTTL, 10*time.Millisecond
+	jobs.RegisterExecutor("TestParked", &funcExecutor{})
+	body := []byte(`{"id":"1","type":"TestParked","queue":"q"}`)
+	ms := func(d time.Duration) int64 { return jobs.Now().Add(d).UnixNano() / int64(time.Millisecond) }
+
+	// not due yet, parked again, requeued as it can't be while disconnected
+	a := &acknowledger{}
+	handle(amqp.Delivery{Acknowledger: a, Body: body, Headers: amqp.Table{dueHeader: ms(time.Minute)}}, make(chan *amqp.Error))
+	if a.settled != "requeue" {
+		t.Errorf("got %s for a job not due, want requeue", a.settled)
+	}
+	a = &acknowledger{}
+	handle(amqp.Delivery{Acknowledger: a, Body: body, Headers: amqp.Table{dueHeader: ms(-time.Second)}}, make(chan *amqp.Error))
+	if a.settled != "ack" {
+		t.Errorf("got %s for a due job, want ack", a.settled)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	SetRoute("TestRouted", Route{RoutingKey: "reports.daily"})
+	defer SetRoute("TestRouted", Route{})
+	d := &rmqdoer{}
+	if err := d.Validate(&jobs.Job{Type: "TestUnrouted", RoutingKey: "jobs.q"}); err != nil {
+		t.Error(err)
+	}
+	if err := d.Validate(&jobs.Job{Type: "TestRouted"}); err != nil {
+		t.Error(err)
+	}
+	err := d.Validate(&jobs.Job{Type: "TestUnrouted"})
+	var verr *jobs.ValidationError
+	if !errors.As(err, &verr) || verr.Field != "RoutingKey" {
+		t.Errorf("got %v, want the missing routing key", err)
+	}
+}
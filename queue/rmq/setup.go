@@ -2,114 +2,368 @@ package rmq
 
 import (
 	"log"
+	"sync"
+	"time"
 
+	"github.com/betacraft/scheduler/config"
 	"github.com/streadway/amqp"
 )
 
-var conn *amqp.Connection
-var consumerCh, pubCh *amqp.Channel
+// names of the queues declared in Setup, or monitored
+var queuesMu sync.Mutex
+var queues []string
 
-// Gives the amqp connection i.e. rabbitmq connection
-// should be used as read only, should not be edited at the
-// user's side
-func GetAMQPConn() *amqp.Connection {
-	return conn
-}
-
-// Gives the rabbitmq publisher channel
-// should be used as read only, should not be edited at the
-// user's side.
-func GetPubChannel() *amqp.Channel {
-	return consumerCh
-}
-
-// Gives the rabbitmq consumer channel.
-// Should be used as read only, should not be edited at the
-// user's side.
-func GetConsumerChannel() *amqp.Channel {
-	return pubCh
-}
-
-// Takes connection url of the rabbitmq, and creates a connection
-func DialConn(conUrl string) (*amqp.Connection, error) {
-	var err error
-	conn, err = amqp.Dial(conUrl)
-	return conn, err
+func addQueue(name string) {
+	queuesMu.Lock()
+	defer queuesMu.Unlock()
+	for _, v := range queues {
+		if v == name {
+			return
+		}
+	}
+	queues = append(queues, name)
 }
 
-// Initiates the publisher channel, and returns it
-// once Initiated, pubCh should not be tampered with
-func InitPubChannel() (*amqp.Channel, error) {
-	var err error
-	pubCh, err = conn.Channel()
-	return pubCh, err
+func queueNames() []string {
+	queuesMu.Lock()
+	defer queuesMu.Unlock()
+	return append([]string{}, queues...)
 }
 
-// Inititates Consumer channel, and returns it.
-// Consumer channel returned here should not be tampered with.
-// this is used by the Monitor() method which must be ran as a goroutine
-func InitConsumerChannel() (*amqp.Channel, error) {
-	var err error
-	consumerCh, err = conn.Channel()
-	return consumerCh, err
+// Configure validates the configuration, connects to rabbitmq, opens the
+// publisher and consumer channels, and declares the exchange and the queues
+// in the configuration. It replaces calling DialConn, InitPubChannel,
+// InitConsumerChannel and Setup.
+func Configure(c config.RMQ) error {
+	err := c.Validate()
+	if err != nil {
+		return err
+	}
+	if c.Exchange == "" {
+		c.Exchange = config.DefaultExchange
+	}
+	if c.ConfirmTimeout > 0 {
+		ConfirmTimeout = time.Duration(c.ConfirmTimeout) * time.Millisecond
+	}
+	if c.PublishChannels > 0 {
+		PoolSize = c.PublishChannels
+	}
+	if c.Prefetch > 0 {
+		Prefetch = c.Prefetch
+	}
+	Ack, err = ParseAckMode(c.AckMode)
+	if err != nil {
+		return err
+	}
+	Delay, err = ParseDelayStrategy(c.DelayStrategy)
+	if err != nil {
+		return err
+	}
+	if len(c.DelayBuckets) > 0 {
+		buckets := make([]time.Duration, 0, len(c.DelayBuckets))
+		for _, v := range c.DelayBuckets {
+			buckets = append(buckets, time.Duration(v)*time.Millisecond)
+		}
+		err = SetDelayBuckets(buckets)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = dial(c.URL)
+	if err != nil {
+		return err
+	}
+	_, err = InitPubChannel()
+	if err != nil {
+		return err
+	}
+	_, err = InitConsumerChannel()
+	if err != nil {
+		return err
+	}
+	configs := make([]RMQConfig, 0, len(c.Queues))
+	for _, q := range c.Queues {
+		configs = append(configs, RMQConfig{
+			ExchangeName:    q.Exchange,
+			QueueName:       q.Name,
+			RoutingKey:      q.RoutingKey,
+			DeadLetterQueue: q.DeadLetterQueue,
+		})
+	}
+	err = Setup(c.Exchange, configs)
+	if err != nil {
+		return err
+	}
+	for _, r := range c.Routes {
+		if r.Exchange != "" {
+			err = declareExchange(GetPubChannel(), r.Exchange)
+			if err != nil {
+				return err
+			}
+			rememberExchange(r.Exchange)
+		}
+		SetRoute(r.Type, Route{Exchange: r.Exchange, RoutingKey: r.RoutingKey})
+	}
+	return nil
 }
 
 // Takes list of RMQConfig, this is used to the queues
 // with a delayed exchange, ExchangeName is used for the
-// exchange creation. Setup call is idempotent, so it can be
+// exchange creation, and the jobs are published to it, unless
+// routed otherwise with SetRoute. Queues with an ExchangeName of
+// their own are bound to that exchange, which is declared too.
+// Setup call is idempotent, so it can be
 // called as many time as wished, although one time should suffice.
-// Note that all the exchange created is a delayed exchange, and
-// is of type topic, so routing is based on topic,
-// other types of exchange are not supported yet.
+// The exchanges and queues are declared again whenever the
+// connection is re-established.
+// Note that all the exchange created is a delayed exchange, or a
+// topic exchange with its delay buckets if Delay is DelayTTL, and
+// routing is based on topic, other types of exchange are not supported yet.
 func Setup(exchangeName string, configs []RMQConfig) error {
-	args := amqp.Table{}
-	args["x-delayed-type"] = "topic" // topic based routing
-	err := pubCh.ExchangeDeclare(
-		exchangeName,        // name
-		"x-delayed-message", // type
-		true,                // durable
-		false,               // auto-deleted
-		false,               // internal
-		false,               // no-wait
-		args,                // arguments
-	)
-
+	ch := GetPubChannel()
+	if ch == nil {
+		return ErrNotConnected
+	}
+	err := declareExchange(ch, exchangeName)
 	if err != nil {
-		log.Fatal("Error creating exchange ", err)
 		return err
 	}
+	rememberExchange(exchangeName)
+	SetExchange(exchangeName)
+	declared := map[string]bool{exchangeName: true}
 	for _, v := range configs {
-		err = declareAndBind(exchangeName, v.QueueName, v.RoutingKey)
+		if v.ExchangeName == "" {
+			v.ExchangeName = exchangeName
+		}
+		if !declared[v.ExchangeName] {
+			err = declareExchange(ch, v.ExchangeName)
+			if err != nil {
+				return err
+			}
+			rememberExchange(v.ExchangeName)
+			declared[v.ExchangeName] = true
+		}
+		err = declareAndBind(ch, v)
+		if err != nil {
+			return err
+		}
+		rememberQueue(v)
+	}
+
+	return nil
+}
+
+// topology declared with Setup, and Configure,
+// to be declared again on reconnecting
+var topologyMu sync.Mutex
+var exchanges []string
+var queueConfigs []RMQConfig
+
+func rememberExchange(name string) {
+	topologyMu.Lock()
+	defer topologyMu.Unlock()
+	for _, v := range exchanges {
+		if v == name {
+			return
+		}
+	}
+	exchanges = append(exchanges, name)
+}
+
+func rememberQueue(c RMQConfig) {
+	topologyMu.Lock()
+	defer topologyMu.Unlock()
+	for i, v := range queueConfigs {
+		if v.QueueName == c.QueueName {
+			queueConfigs[i] = c
+			return
+		}
+	}
+	queueConfigs = append(queueConfigs, c)
+}
+
+func declareTopology(ch *amqp.Channel) error {
+	topologyMu.Lock()
+	defer topologyMu.Unlock()
+	for _, v := range exchanges {
+		err := declareExchange(ch, v)
+		if err != nil {
+			return err
+		}
+	}
+	for _, v := range queueConfigs {
+		err := declareAndBind(ch, v)
 		if err != nil {
 			return err
 		}
 	}
+	return nil
+}
 
+func declareExchange(ch *amqp.Channel, name string) error {
+	if ch == nil {
+		return ErrNotConnected
+	}
+	kind, args := "topic", amqp.Table(nil)
+	if Delay == DelayPlugin {
+		kind = "x-delayed-message"
+		args = amqp.Table{"x-delayed-type": "topic"} // topic based routing
+	}
+	err := ch.ExchangeDeclare(
+		name,  // name
+		kind,  // type
+		true,  // durable
+		false, // auto-deleted
+		false, // internal
+		false, // no-wait
+		args,  // arguments
+	)
+	if err != nil {
+		log.Print("Error creating exchange ", err)
+		return err
+	}
+	if Delay == DelayTTL {
+		return declareBuckets(ch, name)
+	}
 	return nil
 }
 
-func declareAndBind(exchangeName, queueName, routingKey string) error {
-	q, err := pubCh.QueueDeclare(
-		queueName, // name
-		true,      // durable
-		false,     // delete when usused
-		false,     // exclusive
-		false,     // no-wait
-		nil,       // arguments
+// declareAndBind binds the queue to c.ExchangeName
+func declareAndBind(ch *amqp.Channel, c RMQConfig) error {
+	var args amqp.Table
+	if c.DeadLetterQueue != "" {
+		// rejected messages are routed through the default
+		// exchange, directly to the dead letter queue
+		_, err := ch.QueueDeclare(c.DeadLetterQueue, true, false, false, false, nil)
+		if err != nil {
+			log.Print("Error creating dead letter queue ", err)
+			return err
+		}
+		args = amqp.Table{
+			"x-dead-letter-exchange":    "",
+			"x-dead-letter-routing-key": c.DeadLetterQueue,
+		}
+	}
+	q, err := ch.QueueDeclare(
+		c.QueueName, // name
+		true,        // durable
+		false,       // delete when usused
+		false,       // exclusive
+		false,       // no-wait
+		args,        // arguments
 	)
 	if err != nil {
-		log.Fatal("Error creating queue ", err)
+		log.Print("Error creating queue ", err)
 		return err
 	}
-	err = pubCh.QueueBind(
-		q.Name,       // queue name
-		routingKey,   // routing key
-		exchangeName, // exchange
+	err = ch.QueueBind(
+		q.Name,         // queue name
+		c.RoutingKey,   // routing key
+		c.ExchangeName, // exchange
 		false,
 		nil)
 	if err != nil {
-		log.Fatal("Error binding queue ", err)
+		log.Print("Error binding queue ", err)
 		return err
 	}
+	addQueue(q.Name)
 	return nil
 }
+
+// QueueLength returns the number of messages ready in the queue
+func QueueLength(queueName string) (int, error) {
+	ch := GetPubChannel()
+	if ch == nil {
+		return 0, ErrNotConnected
+	}
+	q, err := ch.QueueInspect(queueName)
+	if err != nil {
+		return 0, err
+	}
+	return q.Messages, nil
+}
+
+// PurgeQueue deletes all the messages ready in the queue,
+// and returns the number of messages deleted
+func PurgeQueue(queueName string) (int, error) {
+	ch := GetPubChannel()
+	if ch == nil {
+		return 0, ErrNotConnected
+	}
+	return ch.QueuePurge(queueName, false)
+}
+
+// Redrive moves all the messages from the queue named from, usually
+// a dead letter queue, to the exchange. If routingKey is empty, the
+// routing key a message was originally published with is used.
+// The messages are published without delay, and are removed from the
+// queue only once the broker has confirmed them, a message which is not
+// routed to any queue is left in it, and ErrUnroutable is returned.
+// Returns the number of messages moved.
+func Redrive(from, exchangeName, routingKey string) (int, error) {
+	cch := GetConsumerChannel()
+	if cch == nil {
+		return 0, ErrNotConnected
+	}
+	moved := 0
+	for {
+		d, ok, err := cch.Get(from, false)
+		if err != nil {
+			return moved, err
+		}
+		if !ok {
+			return moved, nil
+		}
+		key := routingKey
+		if key == "" {
+			key = originalRoutingKey(d)
+		}
+		headers := amqp.Table{}
+		for k, v := range d.Headers {
+			if k != "x-delay" && k != "x-death" {
+				headers[k] = v
+			}
+		}
+		id := d.MessageId
+		if id == "" {
+			id, err = randomID()
+			if err != nil {
+				d.Nack(false, true)
+				return moved, err
+			}
+		}
+		err = publish(exchangeName, key, true, amqp.Publishing{
+			DeliveryMode: amqp.Persistent,
+			ContentType:  d.ContentType,
+			MessageId:    id,
+			Body:         d.Body,
+			Headers:      headers,
+		})
+		if err != nil {
+			d.Nack(false, true)
+			return moved, err
+		}
+		err = d.Ack(false)
+		if err != nil {
+			return moved, err
+		}
+		moved++
+	}
+}
+
+// originalRoutingKey returns the routing key the message was published
+// with, dead-lettering with x-dead-letter-routing-key replaces it, the
+// original is kept in the latest x-death entry
+func originalRoutingKey(d amqp.Delivery) string {
+	deaths, _ := d.Headers["x-death"].([]interface{})
+	if len(deaths) > 0 {
+		death, _ := deaths[0].(amqp.Table)
+		keys, _ := death["routing-keys"].([]interface{})
+		if len(keys) > 0 {
+			if key, ok := keys[0].(string); ok {
+				return key
+			}
+		}
+	}
+	return d.RoutingKey
+}
@@ -0,0 +1,23 @@
+package rmq
+
+import (
+	"testing"
+
+	"github.com/streadway/amqp"
+)
+
+func TestOriginalRoutingKey(t *testing.T) {
+	dead := amqp.Delivery{
+		RoutingKey: "test-queue-dlq", // set by x-dead-letter-routing-key
+		Headers: amqp.Table{"x-death": []interface{}{
+			amqp.Table{"queue": "test-queue", "reason": "rejected", "routing-keys": []interface{}{"test.report"}},
+			amqp.Table{"queue": "scheduler.delay.1000", "reason": "expired", "routing-keys": []interface{}{"test.bucket"}},
+		}},
+	}
+	if key := originalRoutingKey(dead); key != "test.report" {
+		t.Errorf("got %q, want the key of the latest death", key)
+	}
+	if key := originalRoutingKey(amqp.Delivery{RoutingKey: "test.direct"}); key != "test.direct" {
+		t.Errorf("got %q without x-death", key)
+	}
+}
@@ -1,5 +1,13 @@
 package sqs
 
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/betacraft/scheduler/config"
+)
+
 const (
 	MAX_QUEUE_DELAY = "900" // 15 minutes
 	MIN_QUEUE_DELAY = "0"   // No delay
@@ -17,6 +25,11 @@ type SQSConfig struct {
 	// Delay should be provided in seconds
 	// Maximum seconds can be 900 i.e. 15 minutes
 	Delay string
+
+	// Optional, name of the queue, in the same region, to which the jobs
+	// which cannot be executed are sent, it is created by Setup, and used
+	// by Monitor if jobs.Config has no DeadLetterQueue.
+	DeadLetterQueue string
 }
 
 func NewSQSConfig(regionName, queueName, delay string) SQSConfig {
@@ -33,6 +46,87 @@ func Setup(configs ...SQSConfig) error {
 			// TODO: change this to idempotent
 			return err
 		}
+		if v.DeadLetterQueue != "" {
+			_, err = CreateQueueWithDelay(v.DeadLetterQueue, v.RegionName, MIN_QUEUE_DELAY)
+			if err != nil {
+				return err
+			}
+			setDeadLetterQueue(v.RegionName, v.QueueName, v.DeadLetterQueue)
+		}
+		addQueue(v.RegionName, v.QueueName)
 	}
 	return nil
 }
+
+// Configure validates the configuration, initialises the regions
+// with the credentials, and creates the queues in the configuration.
+// It replaces calling InitSQSRegions and Setup.
+func Configure(c config.SQS) error {
+	err := c.Validate()
+	if err != nil {
+		return err
+	}
+	visibility := VisibilityTimeout
+	if c.VisibilityTimeout > 0 {
+		visibility = time.Duration(c.VisibilityTimeout) * time.Second
+	}
+	err = checkHeartbeat(visibility)
+	if err != nil {
+		return err
+	}
+	configs := make([]SQSConfig, 0, len(c.Queues))
+	for _, q := range c.Queues {
+		if _, ok := RegionNames[q.Region]; !ok {
+			return &config.Error{Field: "sqs.queues.region", Err: ErrUnknownRegion}
+		}
+		configs = append(configs, SQSConfig{
+			RegionName:      q.Region,
+			QueueName:       q.Name,
+			Delay:           strconv.Itoa(q.Delay),
+			DeadLetterQueue: q.DeadLetterQueue,
+		})
+	}
+	// set once the configuration is known to be valid
+	VisibilityTimeout = visibility
+	if c.Workers > 0 {
+		Workers = c.Workers
+	}
+	initRegions(c.AccessKey, c.SecretKey)
+	return Setup(configs...)
+}
+
+// queues created with Setup, or monitored
+var queuesMu sync.Mutex
+var queues []SQSConfig
+
+func addQueue(regionName, queueName string) {
+	queuesMu.Lock()
+	defer queuesMu.Unlock()
+	for _, v := range queues {
+		if v.RegionName == regionName && v.QueueName == queueName {
+			return
+		}
+	}
+	queues = append(queues, SQSConfig{RegionName: regionName, QueueName: queueName})
+}
+
+func knownQueues() []SQSConfig {
+	queuesMu.Lock()
+	defer queuesMu.Unlock()
+	return append([]SQSConfig{}, queues...)
+}
+
+// dead letter queues set in Setup, by region and queue name
+var deadLetterQueues = map[string]string{}
+
+func setDeadLetterQueue(regionName, queueName, dlq string) {
+	queuesMu.Lock()
+	defer queuesMu.Unlock()
+	deadLetterQueues[regionName+":"+queueName] = dlq
+}
+
+func deadLetterQueue(regionName, queueName string) string {
+	queuesMu.Lock()
+	defer queuesMu.Unlock()
+	return deadLetterQueues[regionName+":"+queueName]
+}
@@ -2,25 +2,32 @@ package sqs
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"runtime"
 	"time"
 
 	"github.com/betacraft/goamz/sqs"
+	"github.com/betacraft/scheduler/config"
 	"github.com/betacraft/scheduler/jobs"
 )
 
-var maxUsableProcs int
-
+// Init registers the sqs implementation with the jobs package,
+// the regions must be initialised with InitSQSRegions, or Configure
 func Init() {
-	maxUsableProcs = runtime.NumCPU()
+	jobs.RegisterDoer(new(sqsdoer))
 	log.Print("registering job scheduler with sqs")
 }
 
-func init() {
-	d := new(sqsdoer)
-	jobs.RegisterDoer(d)
+// New configures the regions and queues with Configure, and returns
+// the sqs implementation, without registering it, check the backend package
+func New(c config.SQS) (jobs.Doer, error) {
+	err := Configure(c)
+	if err != nil {
+		return nil, err
+	}
+	return new(sqsdoer), nil
 }
 
 type sqsdoer struct {
@@ -37,69 +44,204 @@ func (d *sqsdoer) Monitor(c jobs.Config) {
 		log.Print("error getting queue", err)
 		return
 	}
-	messages := make(chan sqs.Message, 2*maxUsableProcs)
-	go processJob(q, messages)
-	done := make(chan bool)
+	if c.DeadLetterQueue == "" {
+		c.DeadLetterQueue = deadLetterQueue(c.RegionName, c.QueueName)
+	}
+	var dlq *sqs.Queue
+	if c.DeadLetterQueue != "" {
+		dlq, err = s.GetQueue(c.DeadLetterQueue)
+		if err != nil {
+			log.Print("error getting dead letter queue", err)
+			return
+		}
+	}
+	addQueue(c.RegionName, c.QueueName)
+	err = checkHeartbeat(VisibilityTimeout)
+	if err != nil {
+		log.Print("not monitoring ", c.QueueName, ": ", err)
+		return
+	}
+	// a message is received only once a worker is free, so that it does
+	// not wait beyond its visibility timeout before being processed
+	free := make(chan bool, Workers)
 	for {
+		jobs.WaitWhilePaused(c.QueueName)
+		free <- true
 		msgs, err := q.ReceiveMessage(1)
 		if err != nil {
+			<-free
 			log.Print("error getting message:", q.Name, err)
 			continue
 		}
 		if len(msgs.Messages) < 1 {
+			<-free
 			log.Print("no messages received:", q.Name, err)
 			continue
 		}
+		// the message is deleted once the job is processed
 		message := msgs.Messages[0]
-		_, err = q.DeleteMessage(&message)
+		log.Print("received message with receipt:", message.MessageId, c.QueueName)
+		go func(msg sqs.Message) {
+			defer func() { <-free }()
+			processJob(q, dlq, msg)
+		}(message)
+	}
+}
+
+// VisibilityTimeout of the queues created by Setup, a received message is
+// kept invisible for this long, and again on every heartbeat of its job.
+// It must be longer than jobs.HeartbeatInterval, Monitor refuses to
+// start otherwise.
+var VisibilityTimeout = 30 * time.Second
+
+// Workers is the number of jobs executed at a time for each monitored queue
+var Workers = runtime.NumCPU()
+
+// Returned by Configure when jobs.HeartbeatInterval is not shorter than
+// VisibilityTimeout, the messages of the running jobs would be redelivered
+var ErrHeartbeatInterval = errors.New("jobs.HeartbeatInterval must be shorter than the visibility timeout")
+
+func checkHeartbeat(visibility time.Duration) error {
+	if jobs.HeartbeatInterval >= visibility {
+		return ErrHeartbeatInterval
+	}
+	return nil
+}
+
+func visibilitySeconds() int {
+	return int(VisibilityTimeout / time.Second)
+}
+
+func extendVisibility(q *sqs.Queue, msg *sqs.Message) error {
+	_, err := q.ChangeMessageVisibility(msg, visibilitySeconds())
+	return err
+}
+
+func deleteMessage(q *sqs.Queue, msg *sqs.Message) {
+	_, err := q.DeleteMessage(msg)
+	if err != nil {
+		log.Print("error deleting message:", q.Name, err)
+		return
+	}
+	log.Print("deleted message with receipt:", msg.MessageId, q.Name)
+}
+
+// Queues lists the queues created with Setup, or being monitored,
+// along with the approximate number of messages in them
+func (d *sqsdoer) Queues() ([]jobs.QueueInfo, error) {
+	list := []jobs.QueueInfo{}
+	for _, v := range knownQueues() {
+		n, err := QueueLength(v.RegionName, v.QueueName)
 		if err != nil {
-			log.Print("error deleting message:", q.Name, err)
-			continue
+			return nil, err
 		}
-		log.Print("deleted message with receipt:", message.MessageId, c.QueueName)
-		messages <- message
+		list = append(list, jobs.QueueInfo{Name: v.QueueName, Region: v.RegionName, Messages: n})
 	}
-	<-done
+	return list, nil
 }
 
-func processJob(q *sqs.Queue, messages chan sqs.Message) {
-	for {
-		msg := <-messages
-		j := &jobs.Job{}
-		err := json.Unmarshal([]byte(msg.Body), j)
-		if err != nil {
-			log.Print("error unmarshalling job", err)
-			continue
+// processJob sends the jobs which cannot be executed to dlq, if not nil.
+// A message is deleted from q only once its job has been processed, and the
+// follow up, i.e. enqueueing the next run or dead-lettering, has succeeded.
+// Otherwise the message is received again, after its visibility timeout.
+func processJob(q, dlq *sqs.Queue, msg sqs.Message) {
+	j := &jobs.Job{}
+	err := json.Unmarshal([]byte(msg.Body), j)
+	if err != nil {
+		log.Print("error unmarshalling job", err)
+		if deadLetter(dlq, msg.Body) {
+			deleteMessage(q, &msg)
+		}
+		return
+	}
+	now := jobs.Now()
+	log.Print("now for job: ", j.Type, j.ID, now)
+	log.Print("exectime for job: ", j.Type, j.ID, j.ExecTime)
+
+	// delay in sqs is at most 15 minutes, enqueue the job again
+	// till its exec time is less than or equal to current time
+	if now.Before(j.ExecTime) {
+		if jobs.IsStale(j) { // cancelled or rescheduled meanwhile
+			log.Printf("dropping stale job, JobID: %s, JobType: %s", j.ID, j.Type)
+			deleteMessage(q, &msg)
+			return
 		}
-		now := time.Now().UTC()
-		log.Print("now for job: ", j.Type, j.ID, now)
-		log.Print("exectime for job: ", j.Type, j.ID, j.ExecTime)
-
-		// run the job if exec time is less than current time
-		// or equal to current time
-		if now.After(j.ExecTime) || now.Equal(j.ExecTime) {
-			// panic point if GetExecutor returns nil
-			err := j.GetExecutor().Execute(j)
-			if err != nil { // don't enqueue if err is found
-				log.Print("error executing job", err)
-			}
-			j.ExecTime = time.Now().UTC().Add(time.Duration(j.Interval) * time.Millisecond).UTC()
-		} else {
-			log.Print("job not executed as exectime is more: ", j.Type, j.ID)
+		log.Print("job not executed as exectime is more: ", j.Type, j.ID)
+		// the same run of the job, sent again without the events
+		// and the store update of jobs.Enqueue
+		err = enqueue(j)
+		if err != nil {
+			log.Print("error enqueuing job: ", err)
+			return
 		}
+		deleteMessage(q, &msg)
+		return
+	}
 
-		if j.IsRecurring {
-			log.Print("next exectime for job: ", j.Type, j.ID, j.ExecTime)
-			err = jobs.Enqueue(j)
-			if err != nil {
-				log.Print("error enqueuing job: ", err)
-				continue
-			}
+	j.SetHeartbeatFunc(func() error { return extendVisibility(q, &msg) })
+	action, err := jobs.Process(j)
+	if err != nil {
+		log.Print("error executing job", err)
+	}
+	switch action {
+	case jobs.ActionDrop:
+		log.Printf("dropping job, JobID: %s, JobType: %s", j.ID, j.Type)
+	case jobs.ActionDeadLetter:
+		log.Printf("dead-lettering job, JobID: %s, JobType: %s", j.ID, j.Type)
+		if !deadLetter(dlq, msg.Body) {
+			return
 		}
+		jobs.Settled(j, action, err)
+	case jobs.ActionRetry, jobs.ActionReschedule, jobs.ActionHold:
+		log.Print("next exectime for job: ", j.Type, j.ID, j.ExecTime)
+		eerr := jobs.Enqueue(j)
+		if eerr != nil {
+			log.Print("error enqueuing job: ", eerr)
+			return
+		}
+		jobs.Settled(j, action, err)
+	}
+	deleteMessage(q, &msg)
+}
+
+// deadLetter returns false if the message could not be sent to dlq
+func deadLetter(dlq *sqs.Queue, body string) bool {
+	if dlq == nil {
+		log.Print("no dead letter queue, dropping message")
+		return true
+	}
+	_, err := dlq.SendMessage(body)
+	if err != nil {
+		log.Print("error sending message to dead letter queue: ", err)
+		return false
+	}
+	return true
+}
+
+// Validate checks for the fields required by sqs, i.e. Queue,
+// a known QueueRegion and ExecTime
+func (d *sqsdoer) Validate(j *jobs.Job) error {
+	switch {
+	case j.Queue == "":
+		return &jobs.ValidationError{Field: "Queue", Err: jobs.ErrMissingField}
+	case j.QueueRegion == "":
+		return &jobs.ValidationError{Field: "QueueRegion", Err: jobs.ErrMissingField}
+	case j.ExecTime.IsZero():
+		return &jobs.ValidationError{Field: "ExecTime", Err: jobs.ErrMissingField}
+	}
+	_, err := SQS(j.QueueRegion)
+	if err != nil {
+		return &jobs.ValidationError{Field: "QueueRegion", Err: err}
 	}
+	return nil
 }
 
 func (d *sqsdoer) Enqueue(j *jobs.Job) error {
+	return enqueue(j)
+}
+
+// enqueue sends the job to its queue, delayed by at most 15 minutes
+func enqueue(j *jobs.Job) error {
 	s, err := SQS(j.QueueRegion)
 	if err != nil {
 		log.Print("error getting region:", err)
@@ -115,10 +257,11 @@ func (d *sqsdoer) Enqueue(j *jobs.Job) error {
 		log.Print("Error marshaling job", err)
 		return err
 	}
-	fmt.Println("delay seconds : ", getDelaySeconds(j.Interval))
+	delay := getDelaySeconds(int64(j.Delay() / time.Millisecond))
+	fmt.Println("delay seconds : ", delay)
 
 	log.Print("message being sent:", string(res), j.ID)
-	_, err = q.SendMessageWithDelay(string(res), getDelaySeconds(j.Interval))
+	_, err = q.SendMessageWithDelay(string(res), delay)
 
 	if err != nil {
 		log.Print("error sending message", err)
@@ -0,0 +1,89 @@
+package sqs
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/betacraft/goamz/sqs"
+	"github.com/betacraft/scheduler/config"
+	"github.com/betacraft/scheduler/jobs"
+)
+
+func TestCheckHeartbeat(t *testing.T) {
+	defer func(h time.Duration) { jobs.HeartbeatInterval = h }(jobs.HeartbeatInterval)
+	jobs.HeartbeatInterval = 10 * time.Second
+	if err := checkHeartbeat(30 * time.Second); err != nil {
+		t.Error(err)
+	}
+	if err := checkHeartbeat(10 * time.Second); err != ErrHeartbeatInterval {
+		t.Errorf("got %v, want ErrHeartbeatInterval", err)
+	}
+}
+
+func TestConfigureVisibilityTimeout(t *testing.T) {
+	defer func(v time.Duration, w int) { VisibilityTimeout, Workers = v, w }(VisibilityTimeout, Workers)
+	VisibilityTimeout, Workers = time.Minute, 1
+	c := config.SQS{AccessKey: "a", SecretKey: "s", VisibilityTimeout: 5, Workers: 3}
+	if err := Configure(c); err != ErrHeartbeatInterval {
+		t.Errorf("got %v, want ErrHeartbeatInterval for 5 seconds", err)
+	}
+	if VisibilityTimeout != time.Minute || Workers != 1 {
+		t.Errorf("got %v and %d workers, want them unchanged by the invalid config", VisibilityTimeout, Workers)
+	}
+	c.VisibilityTimeout = 600
+	if err := Configure(c); err != nil {
+		t.Fatal(err)
+	}
+	if VisibilityTimeout != 10*time.Minute || Workers != 3 {
+		t.Errorf("got %v and %d workers", VisibilityTimeout, Workers)
+	}
+}
+
+func TestInitSQSRegionsRegisters(t *testing.T) {
+	defer jobs.RegisterDoer(jobs.RegisteredDoer())
+	jobs.RegisterDoer(nil)
+	InitSQSRegions("a", "s")
+	if _, ok := jobs.RegisteredDoer().(*sqsdoer); !ok {
+		t.Fatalf("got %T, want sqs registered", jobs.RegisteredDoer())
+	}
+
+	// a registered implementation is kept, as is Configure's
+	other := &sqsdoer{}
+	jobs.RegisterDoer(other)
+	InitSQSRegions("a", "s")
+	if jobs.RegisteredDoer() != other {
+		t.Error("registered implementation replaced")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	defer func(r map[string]*sqs.SQS) { SQSRegions = r }(SQSRegions)
+	initRegions("a", "s")
+	d := &sqsdoer{}
+	now := time.Now()
+	cases := []struct {
+		job   jobs.Job
+		field string
+		err   error
+	}{
+		{jobs.Job{Queue: "q", QueueRegion: "USEast", ExecTime: now}, "", nil},
+		{jobs.Job{QueueRegion: "USEast", ExecTime: now}, "Queue", jobs.ErrMissingField},
+		{jobs.Job{Queue: "q", ExecTime: now}, "QueueRegion", jobs.ErrMissingField},
+		{jobs.Job{Queue: "q", QueueRegion: "USEast"}, "ExecTime", jobs.ErrMissingField},
+		{jobs.Job{Queue: "q", QueueRegion: "Nowhere", ExecTime: now}, "QueueRegion", ErrUnknownRegion},
+	}
+	for _, c := range cases {
+		err := d.Validate(&c.job)
+		if c.err == nil {
+			if err != nil {
+				t.Errorf("%+v: got %v", c.job, err)
+			}
+			continue
+		}
+		var verr *jobs.ValidationError
+		if !errors.As(err, &verr) || verr.Field != c.field || !errors.Is(err, c.err) {
+			t.Errorf("%+v: got %v, want %s: %v", c.job, err, c.field, c.err)
+		}
+	}
+}
@@ -3,14 +3,32 @@ package sqs
 import (
 	"errors"
 	"log"
+	"strconv"
 
 	"github.com/betacraft/goamz/aws"
 	"github.com/betacraft/goamz/sqs"
+	"github.com/betacraft/scheduler/jobs"
 )
 
 var SQSRegions map[string]*sqs.SQS
 
+// Returned for a region name not in RegionNames, or when
+// InitSQSRegions has not been called
+var ErrUnknownRegion = errors.New("Region Name Not found")
+
+// InitSQSRegions connects to the regions in RegionNames. If no queue
+// implementation is registered, it registers sqs, as importing the package
+// used to. The fallback is deprecated, and will be removed, call Init, or
+// use Configure with the backend package.
 func InitSQSRegions(aws_access, aws_secret string) {
+	initRegions(aws_access, aws_secret)
+	if jobs.RegisteredDoer() == nil {
+		log.Print("sqs: no queue implementation registered, registering sqs, call sqs.Init as this fallback will be removed")
+		Init()
+	}
+}
+
+func initRegions(aws_access, aws_secret string) {
 	auth := aws.Auth{AccessKey: aws_access, SecretKey: aws_secret}
 	SQSRegions = make(map[string]*sqs.SQS)
 	for k, v := range RegionNames {
@@ -21,18 +39,27 @@ func InitSQSRegions(aws_access, aws_secret string) {
 func SQS(regionName string) (*sqs.SQS, error) {
 	s, ok := SQSRegions[regionName]
 	if ok == false {
-		return nil, errors.New("Region Name Not found")
+		return nil, ErrUnknownRegion
 	}
 	return s, nil
 }
 
+// GetQueue returns the queue with queueName in the region
+func GetQueue(regionName, queueName string) (*sqs.Queue, error) {
+	s, err := SQS(regionName)
+	if err != nil {
+		return nil, err
+	}
+	return s.GetQueue(queueName)
+}
+
 func CreateQueue(regionName, queueName string) (*sqs.Queue, error) {
 	s, err := SQS(regionName)
 	if err != nil {
 		return nil, err
 	}
 	attrs := map[string]string{
-		"VisibilityTimeout":             "30",
+		"VisibilityTimeout":             strconv.Itoa(visibilitySeconds()),
 		"ReceiveMessageWaitTimeSeconds": "10",
 		"MessageRetentionPeriod":        "900", // 15 minutes
 	}
@@ -48,7 +75,7 @@ func CreateQueueWithDelay(queueName, regionName, delay string) (*sqs.Queue, erro
 		return nil, err
 	}
 	attrs := map[string]string{
-		"VisibilityTimeout":             "30",
+		"VisibilityTimeout":             strconv.Itoa(visibilitySeconds()),
 		"ReceiveMessageWaitTimeSeconds": "20",
 		"DelaySeconds":                  delay,
 	}
@@ -92,3 +119,66 @@ func SendMessage(regionName, queueName, msg string) error {
 	}
 	return nil
 }
+
+// QueueLength returns the approximate number of messages in the queue
+func QueueLength(regionName, queueName string) (int64, error) {
+	q, err := GetQueue(regionName, queueName)
+	if err != nil {
+		return 0, err
+	}
+	res, err := q.GetQueueAttributes("ApproximateNumberOfMessages")
+	if err != nil {
+		return 0, err
+	}
+	for _, a := range res.Attributes {
+		if a.Name == "ApproximateNumberOfMessages" {
+			return strconv.ParseInt(a.Value, 10, 64)
+		}
+	}
+	return 0, nil
+}
+
+// PurgeQueue deletes all the messages in the queue
+func PurgeQueue(regionName, queueName string) error {
+	q, err := GetQueue(regionName, queueName)
+	if err != nil {
+		return err
+	}
+	_, err = q.PurgeQueue()
+	return err
+}
+
+// Redrive moves all the messages from the queue named from, usually a
+// dead letter queue, to the queue named to, in the same region.
+// Returns the number of messages moved.
+func Redrive(regionName, from, to string) (int, error) {
+	src, err := GetQueue(regionName, from)
+	if err != nil {
+		return 0, err
+	}
+	dst, err := GetQueue(regionName, to)
+	if err != nil {
+		return 0, err
+	}
+	moved := 0
+	for {
+		res, err := src.ReceiveMessage(10)
+		if err != nil {
+			return moved, err
+		}
+		if len(res.Messages) == 0 {
+			return moved, nil
+		}
+		for _, m := range res.Messages {
+			_, err = dst.SendMessage(m.Body)
+			if err != nil {
+				return moved, err
+			}
+			_, err = src.DeleteMessage(&m)
+			if err != nil {
+				log.Print("error deleting redriven message: ", m.MessageId, err)
+			}
+			moved++
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package schedulertest
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is a fake clock, which moves only when advanced,
+// it implements jobs.Clock
+type Clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewClock returns a clock set to t
+func NewClock(t time.Time) *Clock {
+	return &Clock{now: t}
+}
+
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Set moves the clock to t, it never moves the clock back
+func (c *Clock) Set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if t.After(c.now) {
+		c.now = t
+	}
+}
+
+func (c *Clock) Advance(d time.Duration) {
+	c.Set(c.Now().Add(d))
+}
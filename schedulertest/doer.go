@@ -0,0 +1,298 @@
+// Package schedulertest helps testing code which enqueues and executes
+// jobs, without a queue. It provides a Doer which records the jobs enqueued,
+// and runs them synchronously, with the executors registered with
+// jobs.RegisterExecutor, when they are due on a fake clock. For eg:
+//
+//  func TestReminder(t *testing.T) {
+//  	d := schedulertest.NewT(t)
+//  	jobs.RegisterExecutor("Reminder", &Reminder{})
+//
+//  	err := jobs.Enqueue(&jobs.Job{ID: "1", Type: "Reminder", Interval: 60000, IsRecurring: true})
+//  	...
+//  	d.AssertEnqueued(t, "Reminder", time.Minute)
+//
+//  	// runs the job thrice, at 1, 2 and 3 minutes
+//  	d.Advance(3 * time.Minute)
+//  	d.AssertRuns(t, "Reminder", 3)
+//  }
+package schedulertest
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/betacraft/scheduler/jobs"
+)
+
+// Start is the time the clock of a new Doer is set to
+var Start = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Enqueued is a job submitted to the Doer
+type Enqueued struct {
+	Job jobs.Job
+
+	// Time, on the clock, the job was enqueued at
+	At time.Time
+
+	// Delay of the job in the queue
+	Delay time.Duration
+}
+
+// Run is an execution of a job by the Doer
+type Run struct {
+	Job jobs.Job
+
+	// Time, on the clock, the job was run at
+	At time.Time
+
+	Action jobs.Action
+	Err    error
+
+	// Error enqueueing the job again, for ActionRetry, ActionReschedule
+	// and ActionHold, the job is lost if it is not nil
+	EnqueueErr error
+}
+
+type pending struct {
+	body []byte
+	due  time.Time
+	seq  int
+}
+
+// Doer implements jobs.Doer, all the jobs are kept in memory
+type Doer struct {
+	Clock *Clock
+
+	mu           sync.Mutex
+	seq          int
+	pending      []pending
+	enqueued     []Enqueued
+	runs         []Run
+	deadLettered []jobs.Job
+
+	// registered before New, restored by Close
+	prevDoer  jobs.Doer
+	prevClock jobs.Clock
+}
+
+// New returns a Doer with its clock set to Start, and registers
+// it with jobs.RegisterDoer, and its clock with jobs.RegisterClock,
+// till Close is called
+func New() *Doer {
+	d := &Doer{Clock: NewClock(Start), prevDoer: jobs.RegisteredDoer(), prevClock: jobs.RegisteredClock()}
+	jobs.RegisterDoer(d)
+	jobs.RegisterClock(d.Clock)
+	return d
+}
+
+// NewT returns a Doer like New, which is closed once the test ends
+func NewT(t testing.TB) *Doer {
+	d := New()
+	t.Cleanup(d.Close)
+	return d
+}
+
+// Close registers back the Doer and the clock registered before New
+func (d *Doer) Close() {
+	jobs.RegisterDoer(d.prevDoer)
+	jobs.RegisterClock(d.prevClock)
+}
+
+// Enqueue keeps the job as json, like the queues do, it is due after
+// its delay on the clock, i.e. at ExecTime or after Interval if not set
+func (d *Doer) Enqueue(j *jobs.Job) error {
+	body, err := json.Marshal(j)
+	if err != nil {
+		return err
+	}
+	now := d.Clock.Now()
+	delay := j.Delay()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.seq++
+	d.pending = append(d.pending, pending{body: body, due: now.Add(delay), seq: d.seq})
+	d.enqueued = append(d.enqueued, Enqueued{Job: *j, At: now, Delay: delay})
+	return nil
+}
+
+// Monitor returns right away, jobs are run by RunDue and Advance
+func (d *Doer) Monitor(c jobs.Config) {}
+
+// RunDue runs the jobs due on the clock, including the ones enqueued
+// while running them, if they are due too. Returns the number of jobs run.
+func (d *Doer) RunDue() int {
+	n := 0
+	for {
+		p, ok := d.next(d.Clock.Now())
+		if !ok {
+			return n
+		}
+		d.run(p)
+		n++
+	}
+}
+
+// Advance moves the clock forward by dur, running the jobs as they become
+// due, in order, with the clock set to the time each one is due at.
+// Returns the number of jobs run.
+func (d *Doer) Advance(dur time.Duration) int {
+	until := d.Clock.Now().Add(dur)
+	n := 0
+	for {
+		p, ok := d.next(until)
+		if !ok {
+			break
+		}
+		d.Clock.Set(p.due)
+		d.run(p)
+		n++
+	}
+	d.Clock.Set(until)
+	return n
+}
+
+// next removes, and returns, the earliest job due by t
+func (d *Doer) next(t time.Time) (pending, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	sort.Slice(d.pending, func(a, b int) bool {
+		if d.pending[a].due.Equal(d.pending[b].due) {
+			return d.pending[a].seq < d.pending[b].seq
+		}
+		return d.pending[a].due.Before(d.pending[b].due)
+	})
+	if len(d.pending) == 0 || d.pending[0].due.After(t) {
+		return pending{}, false
+	}
+	p := d.pending[0]
+	d.pending = d.pending[1:]
+	return p, true
+}
+
+// run processes the job like the queue implementations do
+func (d *Doer) run(p pending) {
+	j := &jobs.Job{}
+	err := json.Unmarshal(p.body, j)
+	if err != nil { // marshalled by Enqueue, never happens
+		panic(err)
+	}
+	at := d.Clock.Now()
+	action, err := jobs.Process(j)
+
+	var eerr error
+	switch action {
+	case jobs.ActionRetry, jobs.ActionReschedule, jobs.ActionHold:
+		eerr = jobs.Enqueue(j)
+		if eerr == nil {
+			jobs.Settled(j, action, err)
+		}
+	case jobs.ActionDeadLetter:
+		d.mu.Lock()
+		d.deadLettered = append(d.deadLettered, *j)
+		d.mu.Unlock()
+		jobs.Settled(j, action, err)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.runs = append(d.runs, Run{Job: *j, At: at, Action: action, Err: err, EnqueueErr: eerr})
+}
+
+// Enqueued returns all the jobs enqueued so far, in order
+func (d *Doer) Enqueued() []Enqueued {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]Enqueued{}, d.enqueued...)
+}
+
+// Runs returns all the executions so far, in order
+func (d *Doer) Runs() []Run {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]Run{}, d.runs...)
+}
+
+// DeadLettered returns the jobs dead-lettered so far
+func (d *Doer) DeadLettered() []jobs.Job {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]jobs.Job{}, d.deadLettered...)
+}
+
+// Pending returns the number of jobs waiting to be due
+func (d *Doer) Pending() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.pending)
+}
+
+// Reset forgets all the jobs, the clock is left as it is
+func (d *Doer) Reset() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.pending = nil
+	d.enqueued = nil
+	d.runs = nil
+	d.deadLettered = nil
+}
+
+// AssertEnqueued fails the test if no job of the type
+// has been enqueued with the delay
+func (d *Doer) AssertEnqueued(t testing.TB, jobType string, delay time.Duration) {
+	t.Helper()
+	delays := []time.Duration{}
+	for _, e := range d.Enqueued() {
+		if e.Job.Type != jobType {
+			continue
+		}
+		if e.Delay == delay {
+			return
+		}
+		delays = append(delays, e.Delay)
+	}
+	if len(delays) == 0 {
+		t.Errorf("no job of type %q enqueued", jobType)
+		return
+	}
+	t.Errorf("no job of type %q enqueued with delay %v, delays enqueued with: %v", jobType, delay, delays)
+}
+
+// AssertNotEnqueued fails the test if a job of the type has been enqueued
+func (d *Doer) AssertNotEnqueued(t testing.TB, jobType string) {
+	t.Helper()
+	for _, e := range d.Enqueued() {
+		if e.Job.Type == jobType {
+			t.Errorf("job of type %q enqueued, JobID: %s", jobType, e.Job.ID)
+			return
+		}
+	}
+}
+
+// AssertNoEnqueueErrors fails the test if a job could not be
+// enqueued again after a run, check Run.EnqueueErr
+func (d *Doer) AssertNoEnqueueErrors(t testing.TB) {
+	t.Helper()
+	for _, r := range d.Runs() {
+		if r.EnqueueErr != nil {
+			t.Errorf("job of type %q not enqueued again after its run at %v, JobID: %s: %v", r.Job.Type, r.At, r.Job.ID, r.EnqueueErr)
+		}
+	}
+}
+
+// AssertRuns fails the test if jobs of the type have not
+// been run exactly n times
+func (d *Doer) AssertRuns(t testing.TB, jobType string, n int) {
+	t.Helper()
+	count := 0
+	for _, r := range d.Runs() {
+		if r.Job.Type == jobType {
+			count++
+		}
+	}
+	if count != n {
+		t.Errorf("jobs of type %q run %d times, expected %d", jobType, count, n)
+	}
+}
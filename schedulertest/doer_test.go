@@ -0,0 +1,172 @@
+package schedulertest
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/betacraft/scheduler/jobs"
+)
+
+type countExecutor struct {
+	runs *int
+	err  error
+}
+
+func (e *countExecutor) New() jobs.Executor { return e }
+
+func (e *countExecutor) Execute(j *jobs.Job) error {
+	*e.runs++
+	return e.err
+}
+
+func register(jobType string, err error) *int {
+	runs := 0
+	jobs.RegisterExecutor(jobType, &countExecutor{runs: &runs, err: err})
+	return &runs
+}
+
+// recorder is a testing.TB recording the failures, instead of failing
+type recorder struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestAdvance(t *testing.T) {
+	d := NewT(t)
+	runs := register("Recurring", nil)
+	err := jobs.Enqueue(&jobs.Job{ID: "1", Type: "Recurring", Interval: 60000, IsRecurring: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := d.Advance(59 * time.Second); n != 0 {
+		t.Errorf("%d jobs run before due", n)
+	}
+	if n := d.Advance(3 * time.Minute); n != 3 || *runs != 3 {
+		t.Errorf("got %d runs, %d executions, want 3", n, *runs)
+	}
+	want := Start.Add(3*time.Minute + 59*time.Second)
+	if !d.Clock.Now().Equal(want) {
+		t.Errorf("clock at %v, want %v", d.Clock.Now(), want)
+	}
+	for i, r := range d.Runs() {
+		if at := Start.Add(time.Duration(i+1) * time.Minute); !r.At.Equal(at) {
+			t.Errorf("run %d at %v, want %v", i, r.At, at)
+		}
+	}
+	if d.Pending() != 1 {
+		t.Errorf("%d jobs pending, want the next occurrence", d.Pending())
+	}
+	d.AssertRuns(t, "Recurring", 3)
+	d.AssertNoEnqueueErrors(t)
+}
+
+func TestRunDue(t *testing.T) {
+	d := NewT(t)
+	register("Once", nil)
+	jobs.Enqueue(&jobs.Job{ID: "1", Type: "Once", ExecTime: Start})
+	jobs.Enqueue(&jobs.Job{ID: "2", Type: "Once", ExecTime: Start.Add(time.Second)})
+	if n := d.RunDue(); n != 1 {
+		t.Errorf("ran %d jobs, want the one due", n)
+	}
+	d.Clock.Advance(time.Second)
+	if n := d.RunDue(); n != 1 {
+		t.Errorf("ran %d jobs, want 1", n)
+	}
+	if d.Pending() != 0 {
+		t.Errorf("%d jobs pending", d.Pending())
+	}
+}
+
+func TestDeadLettered(t *testing.T) {
+	d := NewT(t)
+	register("Broken", jobs.Permanent(errors.New("broken")))
+	jobs.Enqueue(&jobs.Job{ID: "1", Type: "Broken", ExecTime: Start})
+	d.RunDue()
+	if dl := d.DeadLettered(); len(dl) != 1 || dl[0].ID != "1" {
+		t.Errorf("dead-lettered %v", dl)
+	}
+}
+
+func TestAssertEnqueued(t *testing.T) {
+	d := NewT(t)
+	register("Delayed", nil)
+	jobs.Enqueue(&jobs.Job{ID: "1", Type: "Delayed", ExecTime: Start.Add(time.Minute)})
+
+	r := &recorder{TB: t}
+	d.AssertEnqueued(r, "Delayed", time.Minute)
+	d.AssertNotEnqueued(r, "Other")
+	if len(r.errors) != 0 {
+		t.Errorf("unexpected failures: %v", r.errors)
+	}
+	d.AssertEnqueued(r, "Delayed", time.Second)
+	d.AssertEnqueued(r, "Other", time.Minute)
+	d.AssertNotEnqueued(r, "Delayed")
+	if len(r.errors) != 3 {
+		t.Errorf("got failures %v, want 3", r.errors)
+	}
+}
+
+// enqueueing fails once the job has run
+type failingDoer struct {
+	*Doer
+	fail bool
+}
+
+func (f *failingDoer) Enqueue(j *jobs.Job) error {
+	if f.fail {
+		return errors.New("queue down")
+	}
+	return f.Doer.Enqueue(j)
+}
+
+func TestEnqueueErr(t *testing.T) {
+	d := NewT(t)
+	f := &failingDoer{Doer: d}
+	jobs.RegisterDoer(f)
+	register("Flaky", nil)
+	rescheduled := 0
+	jobs.RegisterHook(func(e jobs.Event, j *jobs.Job, err error) {
+		if j.Type == "Flaky" {
+			rescheduled++
+		}
+	}, jobs.EventRescheduled)
+	jobs.Enqueue(&jobs.Job{ID: "1", Type: "Flaky", Interval: 1000, IsRecurring: true})
+	d.Advance(time.Second)
+	f.fail = true
+	d.Advance(time.Second)
+	runs := d.Runs()
+	if len(runs) != 2 || runs[0].EnqueueErr != nil || runs[1].EnqueueErr == nil {
+		t.Fatalf("got runs %+v, want the enqueue error of the second", runs)
+	}
+	if rescheduled != 1 {
+		t.Errorf("rescheduled emitted %d times, want only for the job enqueued again", rescheduled)
+	}
+	r := &recorder{TB: t}
+	d.AssertNoEnqueueErrors(r)
+	if len(r.errors) != 1 {
+		t.Errorf("got failures %v, want 1", r.errors)
+	}
+}
+
+func TestClose(t *testing.T) {
+	before := jobs.RegisteredDoer()
+	d := New()
+	if jobs.RegisteredDoer() != d || jobs.RegisteredClock() != d.Clock {
+		t.Fatal("doer and clock not registered")
+	}
+	d.Close()
+	if jobs.RegisteredDoer() != before {
+		t.Error("doer not restored")
+	}
+	if _, fake := jobs.RegisteredClock().(*Clock); fake {
+		t.Error("clock not restored")
+	}
+}
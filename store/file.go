@@ -0,0 +1,197 @@
+package store
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/betacraft/scheduler/jobs"
+)
+
+// FileStore keeps each record as a json file in Dir, and
+// each result as a .result file.
+// Note that JobData is read back as a generic json value,
+// and not as the type it was saved with.
+type FileStore struct {
+	Dir string
+
+	// when the expired results were last removed
+	mu    sync.Mutex
+	swept time.Time
+}
+
+// NewFileStore creates dir if it does not exist
+func NewFileStore(dir string) (*FileStore, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	return &FileStore{Dir: dir}, nil
+}
+
+func (s *FileStore) Save(r *jobs.Record) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return s.write(s.path(r.Job.ID), b)
+}
+
+// write and rename, so that readers never see a partial file
+func (s *FileStore) write(path string, b []byte) error {
+	tmp, err := ioutil.TempFile(s.Dir, ".tmp-")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(b)
+	tmp.Close()
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *FileStore) Get(id string) (*jobs.Record, error) {
+	r, err := s.read(s.path(id))
+	if os.IsNotExist(err) {
+		return nil, jobs.ErrNotFound
+	}
+	return r, err
+}
+
+func (s *FileStore) List() ([]*jobs.Record, error) {
+	files, err := ioutil.ReadDir(s.Dir)
+	if err != nil {
+		return nil, err
+	}
+	list := []*jobs.Record{}
+	for _, f := range files {
+		if !strings.HasSuffix(f.Name(), ".json") {
+			continue
+		}
+		r, err := s.read(filepath.Join(s.Dir, f.Name()))
+		if os.IsNotExist(err) { // deleted in the meanwhile
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, r)
+	}
+	return list, nil
+}
+
+func (s *FileStore) Delete(id string) error {
+	err := os.Remove(s.path(id))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// SaveResult keeps the result next to the record, as a .result file,
+// and removes the expired result files, every SweepInterval
+func (s *FileStore) SaveResult(r *jobs.Result) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	err = s.write(s.resultPath(r.JobID), b)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	due := jobs.Now().Sub(s.swept) >= SweepInterval
+	if due {
+		s.swept = jobs.Now()
+	}
+	s.mu.Unlock()
+	if due {
+		_, err = s.SweepResults()
+		if err != nil {
+			log.Print("error removing expired results: ", err)
+		}
+	}
+	return nil
+}
+
+// SweepResults removes the expired result files,
+// and returns how many were removed
+func (s *FileStore) SweepResults() (int, error) {
+	files, err := ioutil.ReadDir(s.Dir)
+	if err != nil {
+		return 0, err
+	}
+	now := jobs.Now()
+	n := 0
+	for _, f := range files {
+		if !strings.HasSuffix(f.Name(), ".result") {
+			continue
+		}
+		path := filepath.Join(s.Dir, f.Name())
+		b, err := ioutil.ReadFile(path)
+		if os.IsNotExist(err) { // removed in the meanwhile
+			continue
+		}
+		if err != nil {
+			return n, err
+		}
+		r := &jobs.Result{}
+		err = json.Unmarshal(b, r)
+		if err != nil || now.After(r.ExpiresAt) {
+			os.Remove(path)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// GetResult removes the result file, if it has expired
+func (s *FileStore) GetResult(jobID string) (*jobs.Result, error) {
+	path := s.resultPath(jobID)
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, jobs.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	r := &jobs.Result{}
+	err = json.Unmarshal(b, r)
+	if err != nil {
+		return nil, err
+	}
+	if jobs.Now().After(r.ExpiresAt) {
+		os.Remove(path)
+		return nil, jobs.ErrNotFound
+	}
+	return r, nil
+}
+
+func (s *FileStore) resultPath(jobID string) string {
+	return strings.TrimSuffix(s.path(jobID), ".json") + ".result"
+}
+
+func (s *FileStore) read(path string) (*jobs.Record, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	r := &jobs.Record{}
+	err = json.Unmarshal(b, r)
+	return r, err
+}
+
+// ids may contain characters which are not allowed in file names
+func (s *FileStore) path(id string) string {
+	sum := sha1.Sum([]byte(id))
+	return filepath.Join(s.Dir, hex.EncodeToString(sum[:])+".json")
+}
@@ -0,0 +1,118 @@
+package store
+
+import (
+	"sync"
+	"time"
+
+	"github.com/betacraft/scheduler/jobs"
+)
+
+// MemoryStore keeps the records in memory, they are lost on restart
+type MemoryStore struct {
+	mu      sync.RWMutex
+	records map[string]jobs.Record
+	results map[string]jobs.Result
+	paused  map[string]bool
+
+	// when the expired results were last removed
+	swept time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: map[string]jobs.Record{}, results: map[string]jobs.Result{}, paused: map[string]bool{}}
+}
+
+func (s *MemoryStore) Save(r *jobs.Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[r.Job.ID] = copyRecord(r)
+	return nil
+}
+
+// copyRecord copies the job of the record too, the jobs saved and returned
+// are modified by the scheduler, i.e. Attempts and ExecTime by Process,
+// while others may be reading the record. JobData is not copied.
+func copyRecord(r *jobs.Record) jobs.Record {
+	c := *r
+	if r.Job != nil {
+		j := *r.Job
+		if r.Job.Tags != nil {
+			j.Tags = make(map[string]string, len(r.Job.Tags))
+			for k, v := range r.Job.Tags {
+				j.Tags[k] = v
+			}
+		}
+		c.Job = &j
+	}
+	return c
+}
+
+func (s *MemoryStore) Get(id string) (*jobs.Record, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	r, ok := s.records[id]
+	if !ok {
+		return nil, jobs.ErrNotFound
+	}
+	c := copyRecord(&r)
+	return &c, nil
+}
+
+func (s *MemoryStore) List() ([]*jobs.Record, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := make([]*jobs.Record, 0, len(s.records))
+	for _, r := range s.records {
+		c := copyRecord(&r)
+		list = append(list, &c)
+	}
+	return list, nil
+}
+
+func (s *MemoryStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, id)
+	return nil
+}
+
+// SaveResult also removes the expired results, every SweepInterval
+func (s *MemoryStore) SaveResult(r *jobs.Result) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := jobs.Now()
+	if now.Sub(s.swept) >= SweepInterval {
+		s.sweep(now)
+	}
+	s.results[r.JobID] = *r
+	return nil
+}
+
+// SweepResults removes the expired results, and returns how many were removed
+func (s *MemoryStore) SweepResults() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sweep(jobs.Now()), nil
+}
+
+func (s *MemoryStore) sweep(now time.Time) int {
+	s.swept = now
+	n := 0
+	for k, v := range s.results {
+		if now.After(v.ExpiresAt) {
+			delete(s.results, k)
+			n++
+		}
+	}
+	return n
+}
+
+func (s *MemoryStore) GetResult(jobID string) (*jobs.Result, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	r, ok := s.results[jobID]
+	if !ok || jobs.Now().After(r.ExpiresAt) {
+		return nil, jobs.ErrNotFound
+	}
+	return &r, nil
+}
@@ -0,0 +1,30 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/betacraft/scheduler/jobs"
+)
+
+func TestMemoryStoreCopies(t *testing.T) {
+	s := NewMemoryStore()
+	j := &jobs.Job{ID: "1", Type: "Test", Tags: map[string]string{"tenant": "acme"}}
+	s.Save(&jobs.Record{Job: j, Status: jobs.StatusScheduled})
+
+	// changes to the saved job, or to the one returned, are not stored
+	j.Attempts = 3
+	j.Tags["tenant"] = "other"
+	r, _ := s.Get("1")
+	r.Job.ExecTime = time.Now()
+	list, _ := s.List()
+	list[0].Job.Tags["campaign"] = "42"
+
+	r, _ = s.Get("1")
+	if r.Job == j || r.Job.Attempts != 0 || !r.Job.ExecTime.IsZero() {
+		t.Errorf("stored job changed: %+v", r.Job)
+	}
+	if len(r.Job.Tags) != 1 || r.Job.Tags["tenant"] != "acme" {
+		t.Errorf("stored tags changed: %v", r.Job.Tags)
+	}
+}
@@ -0,0 +1,124 @@
+package store
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/betacraft/scheduler/internal/resp"
+)
+
+// SetPaused and Paused implement jobs.PauseStore,
+// pausing with a MemoryStore is effective only in the process
+func (s *MemoryStore) SetPaused(key string, paused bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if paused {
+		s.paused[key] = true
+	} else {
+		delete(s.paused, key)
+	}
+	return nil
+}
+
+func (s *MemoryStore) Paused() ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := make([]string, 0, len(s.paused))
+	for k := range s.paused {
+		list = append(list, k)
+	}
+	return list, nil
+}
+
+// SetPaused keeps a file for each paused key, in the paused
+// directory under Dir, containing the key
+func (s *FileStore) SetPaused(key string, paused bool) error {
+	sum := sha1.Sum([]byte(key))
+	path := filepath.Join(s.Dir, "paused", hex.EncodeToString(sum[:]))
+	if !paused {
+		err := os.Remove(path)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+	return s.write(path, []byte(key))
+}
+
+func (s *FileStore) Paused() ([]string, error) {
+	dir := filepath.Join(s.Dir, "paused")
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	list := []string{}
+	for _, f := range files {
+		if strings.HasPrefix(f.Name(), ".") {
+			continue
+		}
+		b, err := ioutil.ReadFile(filepath.Join(dir, f.Name()))
+		if os.IsNotExist(err) { // resumed in the meanwhile
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, string(b))
+	}
+	return list, nil
+}
+
+// RedisPauseStore keeps the paused queues and job types in a set,
+// on a Redis compatible server
+type RedisPauseStore struct {
+	// Key of the set, "scheduler:paused" by default
+	Key string
+
+	client *resp.Client
+}
+
+// NewRedisPauseStore takes the address of the server as host:port,
+// password may be empty and db is the database number to be selected.
+func NewRedisPauseStore(addr, password string, db int) *RedisPauseStore {
+	return &RedisPauseStore{Key: "scheduler:paused", client: resp.NewClient(addr, password, db)}
+}
+
+func (s *RedisPauseStore) SetPaused(key string, paused bool) error {
+	cmd := "SREM"
+	if paused {
+		cmd = "SADD"
+	}
+	_, err := s.client.Do(cmd, s.Key, key)
+	return err
+}
+
+func (s *RedisPauseStore) Paused() ([]string, error) {
+	res, err := s.client.Do("SMEMBERS", s.Key)
+	if err != nil {
+		return nil, err
+	}
+	members, _ := res.([]interface{})
+	list := make([]string, 0, len(members))
+	for _, m := range members {
+		if v, ok := m.(string); ok {
+			list = append(list, v)
+		}
+	}
+	return list, nil
+}
+
+// Close closes the connection to the server
+func (s *RedisPauseStore) Close() error {
+	return s.client.Close()
+}
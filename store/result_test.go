@@ -0,0 +1,81 @@
+package store
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/betacraft/scheduler/jobs"
+)
+
+type fixedClock struct {
+	now time.Time
+}
+
+func (c *fixedClock) Now() time.Time { return c.now }
+
+type resultStore interface {
+	jobs.ResultStore
+	SweepResults() (int, error)
+}
+
+func testSweep(t *testing.T, s resultStore) {
+	c := &fixedClock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	jobs.RegisterClock(c)
+	defer jobs.RegisterClock(nil)
+
+	err := s.SaveResult(&jobs.Result{JobID: "old", ExpiresAt: c.now.Add(time.Minute)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// expired, but not swept before SweepInterval
+	c.now = c.now.Add(30 * time.Second)
+	s.SaveResult(&jobs.Result{JobID: "new", ExpiresAt: c.now.Add(time.Hour)})
+	c.now = c.now.Add(time.Minute)
+	if _, err := s.GetResult("new"); err != nil {
+		t.Fatal(err)
+	}
+
+	// swept by the next save
+	s.SaveResult(&jobs.Result{JobID: "newer", ExpiresAt: c.now.Add(time.Hour)})
+	n, err := s.SweepResults()
+	if err != nil || n != 0 {
+		t.Errorf("swept %d, %v, want 0 left to sweep", n, err)
+	}
+	if _, err := s.GetResult("old"); err != jobs.ErrNotFound {
+		t.Errorf("got %v, want ErrNotFound for the expired result", err)
+	}
+	for _, id := range []string{"new", "newer"} {
+		if _, err := s.GetResult(id); err != nil {
+			t.Errorf("%s: %v", id, err)
+		}
+	}
+}
+
+func TestMemoryStoreSweep(t *testing.T) {
+	s := NewMemoryStore()
+	testSweep(t, s)
+	if len(s.results) != 2 {
+		t.Errorf("%d results left, want 2", len(s.results))
+	}
+}
+
+func TestFileStoreSweep(t *testing.T) {
+	s, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testSweep(t, s)
+	files, _ := ioutil.ReadDir(s.Dir)
+	n := 0
+	for _, f := range files {
+		if strings.HasSuffix(f.Name(), ".result") {
+			n++
+		}
+	}
+	if n != 2 {
+		t.Errorf("%d result files left in %s, want 2", n, filepath.Base(s.Dir))
+	}
+}
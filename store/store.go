@@ -0,0 +1,11 @@
+// Package store has the implementations of jobs.Store, jobs.ResultStore and
+// jobs.PauseStore, an in-memory one for a single process and a file based one
+// which survives restarts. RedisPauseStore shares the paused queues and job
+// types between processes on different hosts.
+package store
+
+import "time"
+
+// SweepInterval is how often SaveResult removes the expired results,
+// the ones never read back would pile up otherwise
+var SweepInterval = time.Minute